@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,9 +12,12 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/tobias-piotr/leshy/internal/sqlite"
 	"github.com/tobias-piotr/leshy/messages"
 	pb "github.com/tobias-piotr/leshy/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type server struct {
@@ -20,8 +25,176 @@ type server struct {
 	broadcaster *messages.MessageBroadcaster
 }
 
+type adminServer struct {
+	pb.UnimplementedAdminServiceServer
+	admin *messages.Admin
+}
+
+func (s *adminServer) ListQueues(ctx context.Context, in *pb.ListQueuesRequest) (*pb.ListQueuesResponse, error) {
+	resp, err := s.admin.ListQueues(in)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return resp, nil
+}
+
+func (s *adminServer) ListConsumers(ctx context.Context, in *pb.ListConsumersRequest) (*pb.ListConsumersResponse, error) {
+	resp, err := s.admin.ListConsumers(in)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return resp, nil
+}
+
+func (s *adminServer) BrowseMessages(ctx context.Context, in *pb.BrowseMessagesRequest) (*pb.BrowseMessagesResponse, error) {
+	resp, err := s.admin.BrowseMessages(in)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return resp, nil
+}
+
+func (s *adminServer) SeekConsumer(ctx context.Context, in *pb.SeekConsumerRequest) (*pb.SeekConsumerResponse, error) {
+	resp, err := s.admin.SeekConsumer(in)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return resp, nil
+}
+
+func (s *adminServer) PurgeQueue(ctx context.Context, in *pb.PurgeQueueRequest) (*pb.PurgeQueueResponse, error) {
+	resp, err := s.admin.PurgeQueue(in)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return resp, nil
+}
+
+func (s *adminServer) DeleteConsumer(ctx context.Context, in *pb.DeleteConsumerRequest) (*pb.DeleteConsumerResponse, error) {
+	resp, err := s.admin.DeleteConsumer(in)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return resp, nil
+}
+
+func (s *adminServer) DeleteQueue(ctx context.Context, in *pb.DeleteQueueRequest) (*pb.DeleteQueueResponse, error) {
+	resp, err := s.admin.DeleteQueue(in)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return resp, nil
+}
+
+func (s *adminServer) ListDeadLetters(ctx context.Context, in *pb.ListDeadLettersRequest) (*pb.ListDeadLettersResponse, error) {
+	resp, err := s.admin.ListDeadLetters(in)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return resp, nil
+}
+
+func (s *adminServer) RedriveDeadLetters(ctx context.Context, in *pb.RedriveDeadLettersRequest) (*pb.RedriveDeadLettersResponse, error) {
+	resp, err := s.admin.RedriveDeadLetters(in)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return resp, nil
+}
+
 func (s *server) PublishMessage(ctx context.Context, in *pb.MessageRequest) (*pb.MessageResponse, error) {
-	return s.broadcaster.PublishMessage(in)
+	resp, err := s.broadcaster.PublishMessage(in)
+	if err != nil {
+		return nil, publishError(err)
+	}
+	return resp, nil
+}
+
+func (s *server) PublishMessages(ctx context.Context, in *pb.MessagesRequest) (*pb.MessagesResponse, error) {
+	resp, err := s.broadcaster.PublishMessages(in)
+	if err != nil {
+		return nil, publishError(err)
+	}
+	return resp, nil
+}
+
+func (s *server) PublishStream(srv pb.MessageService_PublishStreamServer) error {
+	// Messages are published one by one, and the next one is not received until the previous one is confirmed,
+	// so a slow storage pushes back on the client through gRPC flow control
+	for seq := uint64(0); ; seq++ {
+		req, err := srv.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		confirm := &pb.PublishConfirm{Id: req.GetId(), Sequence: seq}
+		resp, err := s.broadcaster.PublishMessage(req)
+		if err != nil {
+			slog.Error("Error publishing message from stream", "sequence", seq, "error", err)
+			st := status.Convert(publishError(err))
+			confirm.Code, confirm.Error = uint32(st.Code()), st.Message()
+		} else {
+			confirm.Id = resp.GetId()
+		}
+
+		err = srv.Send(confirm)
+		if err != nil {
+			return fmt.Errorf("sending confirm: %w", err)
+		}
+	}
+}
+
+func (s *server) ReceiveMessages(ctx context.Context, in *pb.ReceiveRequest) (*pb.ReceiveResponse, error) {
+	resp, err := s.broadcaster.ReceiveMessages(ctx, in)
+	if err != nil {
+		return nil, receiveError(err)
+	}
+	return resp, nil
+}
+
+func (s *server) AckMessages(ctx context.Context, in *pb.AckRequest) (*pb.AckResponse, error) {
+	resp, err := s.broadcaster.AckMessages(in)
+	if err != nil {
+		return nil, receiveError(err)
+	}
+	return resp, nil
+}
+
+// adminError converts the error returned by the admin into a gRPC status.
+func adminError(err error) error {
+	switch {
+	case errors.Is(err, messages.ErrQueueNotFound),
+		errors.Is(err, messages.ErrConsumerNotFound),
+		errors.Is(err, messages.ErrMessageNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, messages.ErrInvalidPageToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, messages.ErrMainConsumer):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// publishError converts the error returned by the broadcaster into a gRPC status.
+func publishError(err error) error {
+	if errors.Is(err, messages.ErrMessageExists) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// receiveError converts the error returned by the broadcaster, when receiving or acking, into a gRPC status.
+func receiveError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, messages.ErrInvalidIDs):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return adminError(err)
 }
 
 func (s *server) ReadMessages(srv pb.MessageService_ReadMessagesServer) error {
@@ -37,19 +210,17 @@ func (s *server) ReadMessages(srv pb.MessageService_ReadMessagesServer) error {
 	}()
 
 	initialMsg := make(chan struct {
-		queue    string
-		consumer string
-		err      error
+		req *pb.MessageStreamRequest
+		err error
 	}, 1)
 
 	go func() {
 		// Recv is blocking but it will raise an error when we make return on initialCtx
 		req, err := srv.Recv()
 		initialMsg <- struct {
-			queue    string
-			consumer string
-			err      error
-		}{req.GetQueue(), req.GetConsumer(), err}
+			req *pb.MessageStreamRequest
+			err error
+		}{req, err}
 	}()
 
 	initialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -61,7 +232,7 @@ func (s *server) ReadMessages(srv pb.MessageService_ReadMessagesServer) error {
 		return initialCtx.Err()
 	case msg := <-initialMsg:
 		close(initialMsg)
-		queue, consumer, err := msg.queue, msg.consumer, msg.err
+		req, err := msg.req, msg.err
 		if err != nil {
 			if err == io.EOF {
 				return nil
@@ -69,31 +240,41 @@ func (s *server) ReadMessages(srv pb.MessageService_ReadMessagesServer) error {
 			return err
 		}
 
-		listener = messages.NewListener(messages.Queue(queue), messages.Consumer(consumer))
+		listener = messages.NewListener(messages.Queue(req.GetQueue()), messages.Consumer(req.GetConsumer()))
+		listener.VisibilityTimeout = req.GetVisibilityTimeout().AsDuration()
+		listener.Prefetch = int(req.GetPrefetch())
+		listener.Start = messages.NewStartPosition(req.GetStart())
 		err = s.broadcaster.ReadMessages(listener)
+		if errors.Is(err, messages.ErrMessageNotFound) {
+			return status.Error(codes.NotFound, "start message not found")
+		}
 		if err != nil {
 			return err
 		}
 	}
 
 	// Prepare acks thread
+	// acks is never closed, the thread stops on quit, or once Recv fails, because the stream is done
 	acks := make(chan struct {
-		id  string
+		req *pb.MessageStreamRequest
 		err error
 	})
-	defer close(acks)
+	quit := make(chan struct{})
+	defer close(quit)
 
 	go func() {
 		for {
-			msg, err := srv.Recv()
+			req, err := srv.Recv()
 			select {
-			case <-acks:
+			case acks <- struct {
+				req *pb.MessageStreamRequest
+				err error
+			}{req, err}:
+			case <-quit:
+				return
+			}
+			if err != nil {
 				return
-			default:
-				acks <- struct {
-					id  string
-					err error
-				}{msg.GetId(), err}
 			}
 		}
 	}()
@@ -103,22 +284,43 @@ func (s *server) ReadMessages(srv pb.MessageService_ReadMessagesServer) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-listener.Done():
+			return status.Error(codes.Aborted, "listener was disconnected by the server")
 		case msg := <-listener.Chan:
 			err := srv.Send(msg)
 			if err != nil {
 				return fmt.Errorf("sending message: %w", err)
 			}
 		case ack := <-acks:
-			id, err := ack.id, ack.err
+			req, err := ack.req, ack.err
 			if err != nil {
 				if err == io.EOF {
 					return nil
 				}
 				return err
 			}
-			err = s.broadcaster.Ack(listener, id)
-			if err != nil {
-				return fmt.Errorf("acking message: %w", err)
+			ids := req.GetIds()
+			if req.GetId() != "" {
+				ids = append(ids, req.GetId())
+			}
+			switch {
+			case req.GetKind() == pb.AckKind_ACK_KIND_NACK:
+				err = s.broadcaster.Nack(listener, req.GetRequeueDelay().AsDuration(), req.GetReason(), ids...)
+				if err != nil {
+					return fmt.Errorf("nacking messages: %w", err)
+				}
+			case req.GetCumulative() && req.GetId() == "":
+				return status.Error(codes.InvalidArgument, "cumulative ack requires the id")
+			case req.GetCumulative():
+				err = s.broadcaster.AckUpTo(listener, req.GetId())
+				if err != nil {
+					return fmt.Errorf("acking messages: %w", err)
+				}
+			default:
+				err = s.broadcaster.Ack(listener, ids...)
+				if err != nil {
+					return fmt.Errorf("acking messages: %w", err)
+				}
 			}
 		}
 	}
@@ -128,22 +330,50 @@ func run(ctx context.Context) error {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancel()
 
+	configPath := flag.String("config", "", "Path to the JSON file with queues config")
+	storageKind := flag.String("storage", "", "Default storage of the queues (sqlite, sqlite_log or memory), overrides the config")
+	dataDir := flag.String("data", sqlite.Dir(), "Directory of the SQLite databases")
+	flag.Parse()
+	sqlite.SetDir(*dataDir)
+
+	config := messages.NewConfig()
+	if *configPath != "" {
+		var err error
+		config, err = messages.LoadConfig(*configPath)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+	}
+
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
 		return fmt.Errorf("listening: %w", err)
 	}
 
-	connMap := messages.NewConnectionMap()
+	if *storageKind != "" {
+		config.Defaults.Storage = messages.StorageKind(*storageKind)
+	}
+	storage, err := messages.NewStorage(config)
+	if err != nil {
+		return fmt.Errorf("creating storage: %w", err)
+	}
+
+	broadcaster := messages.NewMessageBroadcaster(storage, config)
 
 	s := grpc.NewServer()
-	pb.RegisterMessageServiceServer(
-		s,
-		&server{broadcaster: messages.NewMessageBroadcaster(messages.NewDistributedSQLStorage(connMap))},
-	)
+	pb.RegisterMessageServiceServer(s, &server{broadcaster: broadcaster})
+	pb.RegisterAdminServiceServer(s, &adminServer{admin: messages.NewAdmin(broadcaster)})
+
+	go func() {
+		slog.Info("Starting redelivery")
+		if err := broadcaster.Start(ctx); err != nil {
+			slog.Error("Error starting redelivery", "error", err)
+		}
+	}()
 
 	go func() {
 		slog.Info("Starting cleaner")
-		cleaner := messages.NewCleaner(connMap)
+		cleaner := messages.NewCleaner(broadcaster)
 		if err := cleaner.Start(ctx); err != nil {
 			slog.Error("Error starting cleaner", "error", err)
 		}
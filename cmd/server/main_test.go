@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tobias-piotr/leshy/messages"
+	pb "github.com/tobias-piotr/leshy/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// newTestClient starts the server in memory, with the messages kept in memory as well, and connects to it.
+func newTestClient(t *testing.T, config *messages.Config) (pb.MessageServiceClient, *messages.MessageBroadcaster) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	broadcaster := messages.NewMessageBroadcaster(messages.NewMemoryStorage(), config)
+	s := grpc.NewServer()
+	pb.RegisterMessageServiceServer(s, &server{broadcaster: broadcaster})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewMessageServiceClient(conn), broadcaster
+}
+
+func TestReadMessagesDisconnectedWhileAcking(t *testing.T) {
+	client, broadcaster := newTestClient(t, messages.NewConfig())
+	admin := messages.NewAdmin(broadcaster)
+
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		stream, err := client.ReadMessages(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = stream.Send(&pb.MessageStreamRequest{Queue: "q"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Once the message is received, the listener is connected
+		_, err = client.PublishMessage(ctx, &pb.MessageRequest{Queue: "q", Data: []byte("x")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Keep the server busy with acks, while the listener is disconnected
+		go func() {
+			for stream.Send(&pb.MessageStreamRequest{Id: "missing"}) == nil {
+			}
+		}()
+		_, err = admin.DeleteQueue(&pb.DeleteQueueRequest{Queue: "q"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.Aborted {
+			t.Fatalf("expected the listener to be disconnected, got %v", err)
+		}
+		cancel()
+	}
+}
+
+func TestReceiveAndAckErrors(t *testing.T) {
+	client, _ := newTestClient(t, messages.NewConfig())
+	ctx := context.Background()
+
+	_, err := client.PublishMessage(ctx, &pb.MessageRequest{Queue: "q", Data: []byte("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.AckRequest
+		code codes.Code
+	}{
+		{"missing queue", &pb.AckRequest{Queue: "missing", Ids: []string{"id"}}, codes.NotFound},
+		{"missing consumer", &pb.AckRequest{Queue: "q", Consumer: "missing", Ids: []string{"id"}}, codes.NotFound},
+		{"no ids", &pb.AckRequest{Queue: "q"}, codes.InvalidArgument},
+		{"empty id", &pb.AckRequest{Queue: "q", Ids: []string{""}}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.AckMessages(ctx, tt.req)
+			if status.Code(err) != tt.code {
+				t.Fatalf("expected %v, got %v", tt.code, err)
+			}
+		})
+	}
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err := client.ReceiveMessages(ctx, &pb.ReceiveRequest{Queue: "empty", WaitTimeout: durationpb.New(time.Minute)})
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Fatalf("expected %v, got %v", codes.DeadlineExceeded, err)
+		}
+	})
+}
+
+func TestReceiveErrorFromContext(t *testing.T) {
+	for err, code := range map[error]codes.Code{
+		context.Canceled: codes.Canceled,
+		fmt.Errorf("x: %w", context.DeadlineExceeded): codes.DeadlineExceeded,
+		messages.ErrConsumerNotFound:                  codes.NotFound,
+	} {
+		if got := status.Code(receiveError(err)); got != code {
+			t.Errorf("expected %v for %v, got %v", code, err, got)
+		}
+	}
+}
+
+func TestPublishStreamConfirmsEachMessage(t *testing.T) {
+	config := messages.NewConfig()
+	config.Defaults.DedupWindow = messages.Duration{Duration: time.Nanosecond}
+	client, _ := newTestClient(t, config)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.PublishStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The repeated id is rejected, once it's outside of the dedup window, without closing the stream
+	rqs := []*pb.MessageRequest{
+		{Queue: "q", Id: "same", Data: []byte("1")},
+		{Queue: "q", Id: "same", Data: []byte("2")},
+		{Queue: "q", Data: []byte("3")},
+	}
+	expected := []codes.Code{codes.OK, codes.AlreadyExists, codes.OK}
+	for i, rq := range rqs {
+		time.Sleep(time.Millisecond)
+		err = stream.Send(rq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		confirm, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if confirm.GetSequence() != uint64(i) || confirm.GetCode() != uint32(expected[i]) {
+			t.Fatalf("message %d: expected %v, got %v", i, expected[i], confirm)
+		}
+		if confirm.GetId() == "" {
+			t.Fatalf("message %d: confirmed without the id", i)
+		}
+	}
+
+	err = stream.CloseSend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	if err != io.EOF {
+		t.Fatalf("expected the stream to be closed, got %v", err)
+	}
+}
@@ -1,26 +1,122 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// autoVacuumIncremental is the value of auto_vacuum pragma, when the incremental vacuum is enabled
+const autoVacuumIncremental = 2
+
 var (
-	dbDir       = "data"
-	dbMigration = `
+	// dbDir is the root directory of all the databases
+	dbDir = "data"
+	// migrated keeps the paths of the databases, that were already migrated, so reopening them doesn't migrate again
+	migrated   = map[string]bool{}
+	migratedMu sync.Mutex
+	// dbMigrations are applied in order, and the index of the last applied one is kept in user_version
+	dbMigrations = []string{
+		`
 CREATE TABLE IF NOT EXISTS messages (
 	id UUID PRIMARY KEY,
 	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 	data BLOB,
 	acked BOOLEAN NOT NULL CHECK (acked IN (0, 1)) DEFAULT 0
 );
-`
+`,
+		`
+ALTER TABLE messages ADD COLUMN visible_at TIMESTAMP;
+ALTER TABLE messages ADD COLUMN delivery_attempts INTEGER NOT NULL DEFAULT 0;
+`,
+		`
+ALTER TABLE messages ADD COLUMN last_error TEXT;
+`,
+		`
+ALTER TABLE messages ADD COLUMN source_id TEXT;
+ALTER TABLE messages ADD COLUMN source_queue TEXT;
+ALTER TABLE messages ADD COLUMN source_consumer TEXT;
+ALTER TABLE messages ADD COLUMN source_attempts INTEGER;
+ALTER TABLE messages ADD COLUMN source_error TEXT;
+`,
+		`
+ALTER TABLE messages ADD COLUMN deliver_at TIMESTAMP;
+`,
+		`
+ALTER TABLE messages ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS messages_pending ON messages (acked, priority DESC, created_at ASC);
+`,
+		`
+ALTER TABLE messages ADD COLUMN headers TEXT;
+`,
+		`
+ALTER TABLE messages ADD COLUMN expires_at TIMESTAMP;
+`,
+	}
+	// logMigrations are applied to the databases, that keep a single log of messages for all the consumers of the queue
+	logMigrations = []string{
+		`
+CREATE TABLE IF NOT EXISTS messages (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	id UUID NOT NULL UNIQUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	data BLOB,
+	headers TEXT,
+	deliver_at TIMESTAMP,
+	priority INTEGER NOT NULL DEFAULT 0,
+	source_id TEXT,
+	source_queue TEXT,
+	source_consumer TEXT,
+	source_attempts INTEGER,
+	source_error TEXT
+);
+CREATE INDEX IF NOT EXISTS messages_order ON messages (priority DESC, created_at ASC);
+CREATE TABLE IF NOT EXISTS consumers (
+	name TEXT PRIMARY KEY,
+	start_seq INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS deliveries (
+	consumer TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	id UUID NOT NULL,
+	acked BOOLEAN NOT NULL CHECK (acked IN (0, 1)) DEFAULT 0,
+	visible_at TIMESTAMP,
+	delivery_attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	PRIMARY KEY (consumer, seq)
+);
+CREATE INDEX IF NOT EXISTS deliveries_id ON deliveries (consumer, id);
+`,
+		`
+ALTER TABLE messages ADD COLUMN expires_at TIMESTAMP;
+`,
+		`
+CREATE INDEX IF NOT EXISTS deliveries_pending ON deliveries (consumer, seq) WHERE acked = 0;
+`,
+		`
+ALTER TABLE consumers ADD COLUMN first_seq INTEGER NOT NULL DEFAULT 0;
+`,
+	}
 )
 
+// Dir returns the root directory of all the databases.
+func Dir() string {
+	return dbDir
+}
+
+// SetDir changes the root directory of all the databases. It should be called before any database is opened.
+func SetDir(dir string) {
+	dbDir = dir
+}
+
 // GetDBFilenames gets names of all the database files in dbDir/path/.
 // If it doesn't exist, GetDBFilenames creates all the directories.
 func GetDBFilenames(path string) ([]string, error) {
@@ -42,6 +138,28 @@ func GetDBFilenames(path string) ([]string, error) {
 	return filenames, nil
 }
 
+// GetDirNames gets names of all the directories in dbDir.
+// If it doesn't exist, GetDirNames creates it.
+func GetDirNames() ([]string, error) {
+	err := os.MkdirAll(dbDir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("making dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(dbDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading dir: %w", err)
+	}
+
+	dirnames := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			dirnames = append(dirnames, e.Name())
+		}
+	}
+	return dirnames, nil
+}
+
 // GetDB connects to the SQLite database inside dbDir/path/name.db and executes the initial migration.
 // When passing mkdir as true, GetDB will make sure that the directory exists.
 func GetDB(path, name string, mkdir bool) (*sql.DB, error) {
@@ -53,27 +171,277 @@ func GetDB(path, name string, mkdir bool) (*sql.DB, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite3", fmt.Sprintf("%s/%s.db", fullpath, name))
+	return open(fullpath, name, dbMigrations)
+}
+
+// GetLogDBNames gets names of all the log databases in dbDir, without the extension.
+// If it doesn't exist, GetLogDBNames creates it.
+func GetLogDBNames() ([]string, error) {
+	err := os.MkdirAll(dbDir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("making dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(dbDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading dir: %w", err)
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".db")
+		if !e.IsDir() && ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// GetLogDB connects to the SQLite database inside dbDir/name.db, that keeps the log of messages for the whole queue.
+// Log databases are kept next to the directories used by GetDB, so both layouts can be used at the same time.
+func GetLogDB(name string) (*sql.DB, error) {
+	err := os.MkdirAll(dbDir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("making dir: %w", err)
+	}
+
+	return open(dbDir, name, logMigrations)
+}
+
+// open connects to the dir/name.db database, and applies the migrations, if it wasn't migrated before.
+func open(dir, name string, migrations []string) (*sql.DB, error) {
+	// Immediate transactions take the write lock upfront, so concurrent writers wait instead of failing
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s/%s.db?_txlock=immediate", dir, name))
 	if err != nil {
 		return nil, fmt.Errorf("opening db: %w", err)
 	}
 
-	_, err = db.Exec(dbMigration)
+	// The file could be removed without RemoveDB, then the new one has to be migrated again
+	path := filepath.Join(dir, name+".db")
+	_, err = os.Stat(path)
+	migratedMu.Lock()
+	done := err == nil && migrated[path]
+	migratedMu.Unlock()
+	if done {
+		return db, nil
+	}
+
+	err = enableIncrementalVacuum(db)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("enabling vacuum: %w", err), db.Close())
+	}
+
+	err = migrate(db, migrations)
 	if err != nil {
-		return nil, fmt.Errorf("migrating db: %w", err)
+		return nil, errors.Join(fmt.Errorf("migrating db: %w", err), db.Close())
 	}
 
+	migratedMu.Lock()
+	migrated[path] = true
+	migratedMu.Unlock()
 	return db, nil
 }
 
-// CopyDB copies entire messages table into the target dbDir/path/name.db database.
-func CopyDB(db *sql.DB, path, name string) error {
+// forget makes the next open migrate the databases at given path again, or the ones inside it, if it's a directory.
+func forget(path string) {
+	migratedMu.Lock()
+	defer migratedMu.Unlock()
+	for p := range migrated {
+		if p == path || strings.HasPrefix(p, path+string(filepath.Separator)) {
+			delete(migrated, p)
+		}
+	}
+}
+
+// enableIncrementalVacuum lets Vacuum reclaim the free pages, without rewriting the whole database.
+// Databases created before it was enabled are rewritten once.
+func enableIncrementalVacuum(db *sql.DB) error {
+	// The mode is changed by the connection, that runs the vacuum
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("getting connection: %w", err)
+	}
+	defer conn.Close()
+
+	var mode int
+	err = conn.QueryRowContext(context.Background(), "PRAGMA auto_vacuum;").Scan(&mode)
+	if err != nil {
+		return fmt.Errorf("reading mode: %w", err)
+	}
+	if mode == autoVacuumIncremental {
+		return nil
+	}
+
+	_, err = conn.ExecContext(context.Background(), "PRAGMA auto_vacuum = INCREMENTAL;")
+	if err != nil {
+		return fmt.Errorf("updating mode: %w", err)
+	}
+	_, err = conn.ExecContext(context.Background(), "VACUUM;")
+	if err != nil {
+		return fmt.Errorf("vacuuming: %w", err)
+	}
+	return nil
+}
+
+// Vacuum returns the free pages of the database to the file system.
+func Vacuum(db *sql.DB) error {
+	// Every free page is returned in a separate step, so all the rows have to be read
+	rows, err := db.Query("PRAGMA incremental_vacuum;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// migrate applies all the migrations that were not applied to the database yet.
+func migrate(db *sql.DB, migrations []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	err = tx.QueryRow("PRAGMA user_version;").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("reading version: %w", err)
+	}
+	if version >= len(migrations) {
+		return nil
+	}
+
+	for _, migration := range migrations[version:] {
+		_, err = tx.Exec(migration)
+		if err != nil {
+			return fmt.Errorf("executing migration: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d;", len(migrations)))
+	if err != nil {
+		return fmt.Errorf("updating version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// DBExists checks if the dbDir/path/name.db database exists.
+func DBExists(path, name string) (bool, error) {
+	_, err := os.Stat(filepath.Join(dbDir, path, name+".db"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading file info: %w", err)
+	}
+	return true, nil
+}
+
+// RemoveDB removes the dbDir/path/name.db database, together with its journal files.
+func RemoveDB(path, name string) error {
+	fullpath := filepath.Join(dbDir, path, name+".db")
+	// Forgotten once the files are gone, so a database opened in the meantime isn't left unmigrated
+	defer forget(fullpath)
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		err := os.Remove(fullpath + suffix)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing file: %w", err)
+		}
+	}
+	return nil
+}
+
+// RemoveDir removes the dbDir/path directory, with all the databases inside.
+func RemoveDir(path string) error {
+	fullpath := filepath.Join(dbDir, path)
+	defer forget(fullpath)
+	return os.RemoveAll(fullpath)
+}
+
+// CopyDB copies the messages matching the condition into the target dbDir/path/name.db database.
+func CopyDB(db *sql.DB, path, name, where string, args ...any) error {
 	_, err := db.Exec(`
 ATTACH DATABASE ? AS consumer_db;
-INSERT INTO consumer_db.messages (id, created_at, data, acked)
-SELECT id, created_at, data, 0 FROM messages;
+INSERT INTO consumer_db.messages (
+	id, created_at, data, headers, acked, deliver_at, expires_at, priority,
+	source_id, source_queue, source_consumer, source_attempts, source_error
+)
+SELECT id, created_at, data, headers, 0, deliver_at, expires_at, priority,
+	source_id, source_queue, source_consumer, source_attempts, source_error
+FROM messages WHERE `+where+` ORDER BY rowid;
 DETACH DATABASE consumer_db;`,
-		fmt.Sprintf("%s/%s/%s.db", dbDir, path, name),
+		append([]any{fmt.Sprintf("%s/%s/%s.db", dbDir, path, name)}, args...)...,
 	)
 	return err
 }
+
+// BackfillDB copies the messages matching the condition, that are missing in the database, from the dbDir/path/name.db
+// database. Copied messages are acked, and all the messages are renumbered, so they keep the order they were published in.
+func BackfillDB(db *sql.DB, path, name, where string, args ...any) error {
+	ctx := context.Background()
+	// The source is attached only to the connection, that runs the copy
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("getting connection: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "ATTACH DATABASE ? AS source_db;", fmt.Sprintf("%s/%s/%s.db", dbDir, path, name))
+	if err != nil {
+		return fmt.Errorf("attaching db: %w", err)
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE source_db;")
+
+	return backfill(ctx, conn, where, args)
+}
+
+// backfill copies the missing messages from the attached source_db, and renumbers the messages, in one transaction.
+func backfill(ctx context.Context, conn *sql.Conn, where string, args []any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+INSERT INTO messages (
+	id, created_at, data, headers, acked, deliver_at, expires_at, priority,
+	source_id, source_queue, source_consumer, source_attempts, source_error
+)
+SELECT id, created_at, data, headers, 1, deliver_at, expires_at, priority,
+	source_id, source_queue, source_consumer, source_attempts, source_error
+FROM source_db.messages WHERE (`+where+`) AND id NOT IN (SELECT id FROM main.messages) ORDER BY rowid;`,
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("copying messages: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("reading affected rows: %w", err)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	// Messages missing in the source are ordered by the time they were saved, before the ones saved in the same second
+	_, err = tx.Exec(`
+CREATE TEMP TABLE backfill_order (pos INTEGER PRIMARY KEY, old INTEGER NOT NULL UNIQUE);
+INSERT INTO backfill_order (old)
+SELECT m.rowid FROM main.messages m LEFT JOIN source_db.messages s ON s.id = m.id ORDER BY m.created_at, s.rowid, m.rowid;
+UPDATE main.messages SET rowid = -rowid;
+UPDATE main.messages SET rowid = (SELECT pos FROM backfill_order WHERE old = -main.messages.rowid);
+DROP TABLE backfill_order;`)
+	if err != nil {
+		return fmt.Errorf("renumbering messages: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
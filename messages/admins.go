@@ -0,0 +1,290 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	pb "github.com/tobias-piotr/leshy/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultBrowsePageSize = 100
+	maxBrowsePageSize     = 1000
+)
+
+// ErrInvalidPageToken is returned when the page token was not returned by the previous browse.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Admin is managing queues, consumers and their messages, outside of the regular delivery.
+type Admin struct{ broadcaster *MessageBroadcaster }
+
+func NewAdmin(broadcaster *MessageBroadcaster) *Admin {
+	return &Admin{broadcaster}
+}
+
+// ListQueues returns the names of all the queues.
+func (a *Admin) ListQueues(rq *pb.ListQueuesRequest) (*pb.ListQueuesResponse, error) {
+	queues, err := a.broadcaster.storage.Queues()
+	if err != nil {
+		return nil, fmt.Errorf("getting queues: %w", err)
+	}
+
+	resp := &pb.ListQueuesResponse{Queues: make([]string, len(queues))}
+	for i, queue := range queues {
+		resp.Queues[i] = string(queue)
+	}
+	return resp, nil
+}
+
+// ListConsumers returns all the consumers of given queue, with the stats of their messages.
+func (a *Admin) ListConsumers(rq *pb.ListConsumersRequest) (*pb.ListConsumersResponse, error) {
+	queue := Queue(rq.GetQueue())
+
+	consumers, err := a.broadcaster.storage.Consumers(queue)
+	if err != nil {
+		return nil, fmt.Errorf("getting consumers: %w", err)
+	}
+
+	resp := &pb.ListConsumersResponse{Consumers: make([]*pb.ConsumerStats, len(consumers))}
+	for i, consumer := range consumers {
+		stats, err := a.broadcaster.storage.Stats(queue, consumer)
+		if err != nil {
+			return nil, fmt.Errorf("getting stats: %w", err)
+		}
+
+		depth, dropped := a.broadcaster.outboxStats(queue, consumer)
+		resp.Consumers[i] = &pb.ConsumerStats{
+			Consumer:      string(consumer),
+			Pending:       uint64(stats.Pending),
+			Scheduled:     uint64(stats.Scheduled),
+			InFlight:      uint64(stats.InFlight),
+			Acked:         uint64(stats.Acked),
+			Listeners:     uint32(a.broadcaster.listenerCount(queue, consumer)),
+			OutboxDepth:   uint64(depth),
+			OutboxDropped: uint64(dropped),
+		}
+		if !stats.OldestUnacked.IsZero() {
+			resp.Consumers[i].OldestUnackedAge = durationpb.New(time.Since(stats.OldestUnacked))
+		}
+	}
+	return resp, nil
+}
+
+// BrowseMessages returns a page of the messages for given queue + consumer combination, without leasing or acking them.
+func (a *Admin) BrowseMessages(rq *pb.BrowseMessagesRequest) (*pb.BrowseMessagesResponse, error) {
+	queue, consumer := Queue(rq.GetQueue()), Consumer(rq.GetConsumer())
+	if consumer == "" {
+		consumer = Consumer(queue)
+	}
+
+	filter := BrowseFilter{Limit: int(rq.GetPageSize())}
+	switch {
+	case filter.Limit == 0:
+		filter.Limit = defaultBrowsePageSize
+	case filter.Limit > maxBrowsePageSize:
+		filter.Limit = maxBrowsePageSize
+	}
+	switch rq.GetStatus() {
+	case pb.MessageStatus_MESSAGE_STATUS_PENDING:
+		filter.Status = StatusPending
+	case pb.MessageStatus_MESSAGE_STATUS_ACKED:
+		filter.Status = StatusAcked
+	}
+	if rq.GetPageToken() != "" {
+		after, err := strconv.ParseInt(rq.GetPageToken(), 10, 64)
+		if err != nil || after < 0 {
+			return nil, ErrInvalidPageToken
+		}
+		filter.After = after
+	}
+
+	msgs, next, err := a.broadcaster.storage.Browse(queue, consumer, filter)
+	if err != nil {
+		return nil, fmt.Errorf("browsing messages: %w", err)
+	}
+
+	resp := &pb.BrowseMessagesResponse{Messages: make([]*pb.BrowsedMessage, len(msgs))}
+	for i, msg := range msgs {
+		resp.Messages[i] = &pb.BrowsedMessage{
+			Id:               msg.ID,
+			CreatedAt:        timestamppb.New(msg.CreatedAt),
+			Data:             msg.Data,
+			Headers:          msg.Headers,
+			DeliveryAttempts: uint32(msg.DeliveryAttempts),
+			LastError:        msg.LastError,
+			Priority:         int32(msg.Priority),
+			Acked:            msg.Acked,
+		}
+		if !msg.DeliverAt.IsZero() {
+			resp.Messages[i].DeliverAt = timestamppb.New(msg.DeliverAt)
+		}
+		if !msg.VisibleAt.IsZero() {
+			resp.Messages[i].VisibleAt = timestamppb.New(msg.VisibleAt)
+		}
+	}
+	if next != 0 {
+		resp.NextPageToken = strconv.FormatInt(next, 10)
+	}
+
+	return resp, nil
+}
+
+// SeekConsumer moves the consumer to given position, so the messages published since it are delivered again,
+// and the ones published before it are skipped.
+func (a *Admin) SeekConsumer(rq *pb.SeekConsumerRequest) (*pb.SeekConsumerResponse, error) {
+	queue, consumer := Queue(rq.GetQueue()), Consumer(rq.GetConsumer())
+	if consumer == "" {
+		consumer = Consumer(queue)
+	}
+
+	replayed, skipped, err := a.broadcaster.storage.Seek(queue, consumer, NewStartPosition(rq.GetPosition()))
+	if err != nil {
+		return nil, fmt.Errorf("seeking consumer: %w", err)
+	}
+	slog.Info("Moved consumer", "queue", queue, "consumer", consumer, "replayed", replayed, "skipped", skipped)
+
+	// Deliver the replayed messages to the listeners that are already connected
+	if replayed > 0 {
+		a.broadcaster.notify(queue)
+		go a.broadcaster.redeliverConsumer(queue, consumer)
+	}
+
+	return &pb.SeekConsumerResponse{Replayed: uint64(replayed), Skipped: uint64(skipped)}, nil
+}
+
+// PurgeQueue removes all the messages of the queue, for every consumer.
+func (a *Admin) PurgeQueue(rq *pb.PurgeQueueRequest) (*pb.PurgeQueueResponse, error) {
+	queue := Queue(rq.GetQueue())
+
+	removed, err := a.broadcaster.storage.Purge(queue)
+	if err != nil {
+		return nil, fmt.Errorf("purging queue: %w", err)
+	}
+
+	resp := &pb.PurgeQueueResponse{Removed: make(map[string]uint64, len(removed))}
+	for consumer, n := range removed {
+		resp.Removed[string(consumer)] = uint64(n)
+	}
+	slog.Info("Purged queue", "queue", queue, "removed", removed)
+
+	return resp, nil
+}
+
+// DeleteConsumer disconnects the listeners of the consumer, and removes its database,
+// so it no longer receives the messages published to the queue.
+func (a *Admin) DeleteConsumer(rq *pb.DeleteConsumerRequest) (*pb.DeleteConsumerResponse, error) {
+	queue, consumer := Queue(rq.GetQueue()), Consumer(rq.GetConsumer())
+
+	// Listeners would recreate the database on the next ack
+	a.broadcaster.disconnect(queue, consumer)
+
+	err := a.broadcaster.storage.DeleteConsumer(queue, consumer)
+	if err != nil {
+		return nil, fmt.Errorf("deleting consumer: %w", err)
+	}
+	slog.Info("Deleted consumer", "queue", queue, "consumer", consumer)
+
+	return &pb.DeleteConsumerResponse{}, nil
+}
+
+// DeleteQueue disconnects all the listeners of the queue, and removes all of its databases.
+func (a *Admin) DeleteQueue(rq *pb.DeleteQueueRequest) (*pb.DeleteQueueResponse, error) {
+	queue := Queue(rq.GetQueue())
+
+	a.broadcaster.disconnect(queue, "")
+
+	err := a.broadcaster.storage.DeleteQueue(queue)
+	if err != nil {
+		return nil, fmt.Errorf("deleting queue: %w", err)
+	}
+	slog.Info("Deleted queue", "queue", queue)
+
+	return &pb.DeleteQueueResponse{}, nil
+}
+
+// ListDeadLetters returns the messages from the dead-letter queue, together with their origin.
+func (a *Admin) ListDeadLetters(rq *pb.ListDeadLettersRequest) (*pb.ListDeadLettersResponse, error) {
+	filter := newDeadLetterFilter(rq.GetFilter())
+	filter.Limit = int(rq.GetLimit())
+
+	msgs, err := a.broadcaster.storage.GetDeadLetters(Queue(rq.GetQueue()), filter)
+	if err != nil {
+		return nil, fmt.Errorf("getting dead letters: %w", err)
+	}
+
+	deadLetters := make([]*pb.DeadLetter, len(msgs))
+	for i, msg := range msgs {
+		deadLetters[i] = &pb.DeadLetter{
+			Id:               msg.ID,
+			CreatedAt:        timestamppb.New(msg.CreatedAt),
+			Data:             msg.Data,
+			Headers:          msg.Headers,
+			SourceId:         msg.DeadLetter.ID,
+			SourceQueue:      string(msg.DeadLetter.Queue),
+			SourceConsumer:   string(msg.DeadLetter.Consumer),
+			DeliveryAttempts: uint32(msg.DeadLetter.DeliveryAttempts),
+			Reason:           msg.DeadLetter.Reason,
+		}
+	}
+
+	return &pb.ListDeadLettersResponse{DeadLetters: deadLetters}, nil
+}
+
+// RedriveDeadLetters moves the messages from the dead-letter queue back to the consumers they came from.
+func (a *Admin) RedriveDeadLetters(rq *pb.RedriveDeadLettersRequest) (*pb.RedriveDeadLettersResponse, error) {
+	queue := Queue(rq.GetQueue())
+
+	msgs, err := a.broadcaster.storage.GetDeadLetters(queue, newDeadLetterFilter(rq.GetFilter()))
+	if err != nil {
+		return nil, fmt.Errorf("getting dead letters: %w", err)
+	}
+
+	ids := make([]string, len(msgs))
+	for i, msg := range msgs {
+		err = a.broadcaster.storage.Requeue(
+			msg.DeadLetter.Queue,
+			msg.DeadLetter.Consumer,
+			Message{ID: msg.DeadLetter.ID, Data: msg.Data, Headers: msg.Headers, Priority: msg.Priority},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("requeueing message: %w", err)
+		}
+		ids[i] = msg.ID
+	}
+
+	err = a.broadcaster.storage.Delete(queue, ids)
+	if err != nil {
+		return nil, fmt.Errorf("deleting dead letters: %w", err)
+	}
+
+	slog.Info("Redrove dead letters", "queue", queue, "messages", len(msgs))
+
+	// Deliver the messages to the listeners that are already connected
+	sources := make(map[Queue]map[Consumer]bool)
+	for _, msg := range msgs {
+		if sources[msg.DeadLetter.Queue] == nil {
+			sources[msg.DeadLetter.Queue] = make(map[Consumer]bool)
+		}
+		sources[msg.DeadLetter.Queue][msg.DeadLetter.Consumer] = true
+	}
+	for queue, consumers := range sources {
+		for consumer := range consumers {
+			go a.broadcaster.redeliverConsumer(queue, consumer)
+		}
+	}
+
+	return &pb.RedriveDeadLettersResponse{Redriven: uint32(len(msgs))}, nil
+}
+
+func newDeadLetterFilter(filter *pb.DeadLetterFilter) DeadLetterFilter {
+	return DeadLetterFilter{
+		IDs:      filter.GetIds(),
+		Consumer: Consumer(filter.GetSourceConsumer()),
+		Reason:   filter.GetReason(),
+	}
+}
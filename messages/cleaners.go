@@ -13,12 +13,22 @@ import (
 var (
 	defaultCleanerInterval = 1 * time.Minute
 	defaultCleanerTimeout  = 1 * time.Minute
+	defaultVacuumInterval  = 1 * time.Hour
 )
 
-type Cleaner struct{ connMap *ConnectionMap }
+// expiredReason is recorded with the expired messages, that are moved to the dead-letter queue
+var expiredReason = "expired"
 
-func NewCleaner(connMap *ConnectionMap) *Cleaner {
-	return &Cleaner{connMap}
+type Cleaner struct {
+	broadcaster *MessageBroadcaster
+	// lastVacuum is when the space of removed messages was given back for the last time
+	lastVacuum time.Time
+}
+
+// NewCleaner creates the cleaner for the storage of the broadcaster,
+// which is also used to move the expired messages to the dead-letter queues.
+func NewCleaner(broadcaster *MessageBroadcaster) *Cleaner {
+	return &Cleaner{broadcaster: broadcaster, lastVacuum: time.Now()}
 }
 
 func (c *Cleaner) Start(ctx context.Context) error {
@@ -58,7 +68,12 @@ func (c *Cleaner) Clean(ctx context.Context) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := c.removeOldMessages()
+		// Expired messages go first, so they are not removed by the retention before reaching the dead-letter queue
+		err := c.removeExpiredMessages()
+		if err != nil {
+			errs <- fmt.Errorf("removing expired messages: %w", err)
+		}
+		err = c.removeOldMessages()
 		if err != nil {
 			errs <- fmt.Errorf("removing old messages: %w", err)
 		}
@@ -97,11 +112,120 @@ cleaner:
 }
 
 func (c *Cleaner) removeStaleConnections() error {
-	removedCount := c.connMap.Clean()
+	removedCount, err := c.broadcaster.storage.CloseIdle()
 	slog.Info("Done cleaning stale connections", "removed", removedCount)
+	if err != nil {
+		return fmt.Errorf("closing connections: %w", err)
+	}
+	return nil
+}
+
+// removeExpiredMessages removes the expired messages of every consumer,
+// or moves them to the dead-letter queue, if the consumer is configured to do so.
+func (c *Cleaner) removeExpiredMessages() error {
+	storage := c.broadcaster.storage
+	queues, err := storage.Queues()
+	if err != nil {
+		return fmt.Errorf("getting queues: %w", err)
+	}
+
+	total := 0
+	for _, queue := range queues {
+		consumers, err := storage.Consumers(queue)
+		// Queue could be deleted in the meantime
+		if errors.Is(err, ErrQueueNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("getting consumers: %w", err)
+		}
+
+		// Dead-letter for all the consumers first, because the storage can share the messages between them
+		for _, consumer := range consumers {
+			if !c.broadcaster.config.Options(queue, consumer).DeadLettersExpired() {
+				continue
+			}
+			msgs, err := storage.GetExpired(queue, consumer, 0)
+			if err != nil {
+				return fmt.Errorf("getting expired messages: %w", err)
+			}
+			for _, msg := range msgs {
+				msg.LastError = expiredReason
+				err = c.broadcaster.deadLetter(queue, consumer, msg)
+				if err != nil {
+					return fmt.Errorf("dead-lettering message: %w", err)
+				}
+			}
+		}
+
+		for _, consumer := range consumers {
+			removed, err := storage.DeleteExpired(queue, consumer)
+			if err != nil {
+				return fmt.Errorf("deleting expired messages: %w", err)
+			}
+			if removed != 0 {
+				slog.Info("Removed expired messages", "queue", queue, "consumer", consumer, "removed", removed)
+			}
+			total += removed
+		}
+	}
+	slog.Info("Done cleaning expired messages", "removed", total)
+
 	return nil
 }
 
+// removeOldMessages removes the messages outside of the retention of every consumer,
+// and from time to time gives back the space they used.
 func (c *Cleaner) removeOldMessages() error {
+	queues, err := c.broadcaster.storage.Queues()
+	if err != nil {
+		return fmt.Errorf("getting queues: %w", err)
+	}
+
+	total := 0
+	for _, queue := range queues {
+		consumers, err := c.broadcaster.storage.Consumers(queue)
+		// Queue could be deleted in the meantime
+		if errors.Is(err, ErrQueueNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("getting consumers: %w", err)
+		}
+
+		for _, consumer := range consumers {
+			opts := c.broadcaster.config.Options(queue, consumer)
+			retention := opts.Retention()
+			// The dedup looks up published ids in the main consumer, so keep them for the whole window
+			if consumer == Consumer(queue) {
+				retention = retention.AtLeast(opts.DedupWindow.Duration)
+			}
+			if retention == (Retention{}) {
+				continue
+			}
+			removed, err := c.broadcaster.storage.Trim(queue, consumer, retention)
+			if err != nil {
+				return fmt.Errorf("trimming messages: %w", err)
+			}
+			if removed != 0 {
+				slog.Info("Removed old messages", "queue", queue, "consumer", consumer, "removed", removed)
+			}
+			total += removed
+		}
+	}
+	slog.Info("Done cleaning old messages", "removed", total)
+
+	if time.Since(c.lastVacuum) < defaultVacuumInterval {
+		return nil
+	}
+	for _, queue := range queues {
+		err = c.broadcaster.storage.Vacuum(queue)
+		if err != nil {
+			return fmt.Errorf("vacuuming: %w", err)
+		}
+	}
+	c.lastVacuum = time.Now()
+	slog.Info("Done vacuuming", "queues", len(queues))
+
 	return nil
 }
@@ -0,0 +1,211 @@
+package messages
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultDeadLetterSuffix is appended to the queue name, to get the dead-letter queue, when it's not configured
+var defaultDeadLetterSuffix = ".dlq"
+
+var defaultQueueOptions = QueueOptions{
+	VisibilityTimeout: Duration{30 * time.Second},
+	DedupWindow:       Duration{5 * time.Minute},
+	Storage:           StorageSQLite,
+	OutboxSize:        100,
+	OutboxPolicy:      OutboxDrop,
+}
+
+// StorageKind names the storage, that keeps the messages of the queue.
+type StorageKind string
+
+const (
+	// StorageSQLite keeps a copy of the messages in a separate SQLite database for every consumer
+	StorageSQLite StorageKind = "sqlite"
+	// StorageSQLiteLog keeps the messages in one SQLite database per queue, shared by all the consumers
+	StorageSQLiteLog StorageKind = "sqlite_log"
+	// StorageMemory keeps the messages in memory, so they are lost on restart
+	StorageMemory StorageKind = "memory"
+)
+
+// OutboxPolicy decides what happens to a new message, when the outboxes of the listeners it could go to are full.
+// Messages are never put in an outbox without room for them, unless the listener makes the publisher wait.
+type OutboxPolicy string
+
+const (
+	// OutboxBlock makes the publisher wait, until the listener has room for the message, or the wait times out
+	OutboxBlock OutboxPolicy = "block"
+	// OutboxDrop leaves the message for the redelivery, without leasing it, so no delivery attempt is counted
+	OutboxDrop OutboxPolicy = "drop"
+	// OutboxDisconnect disconnects the listener, and leaves the message for the other listeners
+	OutboxDisconnect OutboxPolicy = "disconnect"
+)
+
+// Duration is a time.Duration that is represented as a string (e.g. "30s") in JSON.
+type Duration struct{ time.Duration }
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("unmarshaling duration: %w", err)
+	}
+	d.Duration, err = time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("parsing duration: %w", err)
+	}
+	return nil
+}
+
+// QueueOptions describes how messages are delivered for a queue, or a single consumer of the queue.
+// Zero values mean that the value is inherited from the broader scope.
+type QueueOptions struct {
+	// VisibilityTimeout is how long a delivered message is leased to the listener, before it is delivered again
+	VisibilityTimeout Duration `json:"visibility_timeout"`
+	// RetryDelay is how long a nacked message waits before it is delivered again, unless the nack specifies it
+	RetryDelay Duration `json:"retry_delay"`
+	// MaxDeliveryAttempts is how many times a message is delivered, before it is moved to the dead-letter queue
+	// Zero means that the message is delivered until it is acked
+	MaxDeliveryAttempts int `json:"max_delivery_attempts"`
+	// DeadLetterQueue is where the messages go after reaching max delivery attempts, defaults to the queue name with ".dlq"
+	DeadLetterQueue Queue `json:"dead_letter_queue"`
+	// DedupWindow is for how long a publish with already used id returns the original message, instead of failing
+	// Published ids are looked up in the main consumer, so the age retention of the main consumer is never shorter than the window,
+	// but MaxMessages and MaxBytes can still remove the messages sooner, and shorten it
+	DedupWindow Duration `json:"dedup_window"`
+	// Storage is where the messages of the queue are kept, it can't be overridden for consumers
+	Storage StorageKind `json:"storage"`
+	// AckedRetention is how long the acked messages are kept, zero keeps them until they are removed by other limits
+	AckedRetention Duration `json:"acked_retention"`
+	// UnackedRetention is how long the messages are kept even if they are not acked, zero keeps them until they are acked
+	UnackedRetention Duration `json:"unacked_retention"`
+	// MaxMessages caps the number of messages kept for every consumer, the oldest are removed first
+	MaxMessages int `json:"max_messages"`
+	// MaxBytes caps the size of messages kept for every consumer, the oldest are removed first
+	MaxBytes int64 `json:"max_bytes"`
+	// DeadLetterExpired moves the expired messages to the dead-letter queue, instead of removing them
+	// It's a pointer, so that a consumer can turn it off, when it's on for the queue
+	DeadLetterExpired *bool `json:"dead_letter_expired"`
+	// OutboxSize is how many messages can wait for every listener, before they are sent to the client
+	OutboxSize int `json:"outbox_size"`
+	// OutboxPolicy is what happens to a new message for a listener, which outbox is full
+	OutboxPolicy OutboxPolicy `json:"outbox_policy"`
+	// Consumers overrides the options for specific consumers of the queue
+	Consumers map[Consumer]QueueOptions `json:"consumers,omitempty"`
+}
+
+// merge overrides the options with all the non-zero values from other.
+func (o QueueOptions) merge(other QueueOptions) QueueOptions {
+	if other.VisibilityTimeout.Duration != 0 {
+		o.VisibilityTimeout = other.VisibilityTimeout
+	}
+	if other.RetryDelay.Duration != 0 {
+		o.RetryDelay = other.RetryDelay
+	}
+	if other.MaxDeliveryAttempts != 0 {
+		o.MaxDeliveryAttempts = other.MaxDeliveryAttempts
+	}
+	if other.DeadLetterQueue != "" {
+		o.DeadLetterQueue = other.DeadLetterQueue
+	}
+	if other.DedupWindow.Duration != 0 {
+		o.DedupWindow = other.DedupWindow
+	}
+	if other.Storage != "" {
+		o.Storage = other.Storage
+	}
+	if other.AckedRetention.Duration != 0 {
+		o.AckedRetention = other.AckedRetention
+	}
+	if other.UnackedRetention.Duration != 0 {
+		o.UnackedRetention = other.UnackedRetention
+	}
+	if other.MaxMessages != 0 {
+		o.MaxMessages = other.MaxMessages
+	}
+	if other.MaxBytes != 0 {
+		o.MaxBytes = other.MaxBytes
+	}
+	if other.DeadLetterExpired != nil {
+		o.DeadLetterExpired = other.DeadLetterExpired
+	}
+	if other.OutboxSize != 0 {
+		o.OutboxSize = other.OutboxSize
+	}
+	if other.OutboxPolicy != "" {
+		o.OutboxPolicy = other.OutboxPolicy
+	}
+	return o
+}
+
+// Retention returns the limits, after which the cleaner removes the messages.
+func (o QueueOptions) Retention() Retention {
+	return Retention{
+		AckedMaxAge:   o.AckedRetention.Duration,
+		UnackedMaxAge: o.UnackedRetention.Duration,
+		MaxMessages:   o.MaxMessages,
+		MaxBytes:      o.MaxBytes,
+	}
+}
+
+// DeadLettersExpired reports whether the expired messages are moved to the dead-letter queue.
+func (o QueueOptions) DeadLettersExpired() bool {
+	return o.DeadLetterExpired != nil && *o.DeadLetterExpired
+}
+
+// Config holds the default options, and the options for specific queues.
+type Config struct {
+	Defaults QueueOptions           `json:"defaults"`
+	Queues   map[Queue]QueueOptions `json:"queues"`
+}
+
+func NewConfig() *Config {
+	return &Config{Queues: make(map[Queue]QueueOptions)}
+}
+
+// LoadConfig reads the config from JSON file under given path.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+
+	config := NewConfig()
+	err = json.Unmarshal(b, config)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling config: %w", err)
+	}
+
+	return config, nil
+}
+
+// Options returns the options for given queue + consumer combination.
+// Consumer options take precedence over queue options, which take precedence over the defaults.
+func (c *Config) Options(queue Queue, consumer Consumer) QueueOptions {
+	opts := defaultQueueOptions.merge(c.Defaults)
+	queueOpts, ok := c.Queues[queue]
+	if !ok {
+		return opts
+	}
+	opts = opts.merge(queueOpts)
+	consumerOpts, ok := queueOpts.Consumers[consumer]
+	if !ok {
+		return opts
+	}
+	return opts.merge(consumerOpts)
+}
+
+// DeadLetterQueue returns the dead-letter queue for given queue + consumer combination.
+func (c *Config) DeadLetterQueue(queue Queue, consumer Consumer) Queue {
+	dlq := c.Options(queue, consumer).DeadLetterQueue
+	if dlq == "" {
+		return queue + Queue(defaultDeadLetterSuffix)
+	}
+	return dlq
+}
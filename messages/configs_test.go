@@ -0,0 +1,30 @@
+package messages
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConsumerTurnsOffDeadLetterExpired(t *testing.T) {
+	config := NewConfig()
+	err := json.Unmarshal([]byte(`{
+		"queues": {
+			"q": {
+				"dead_letter_expired": true,
+				"consumers": {"off": {"dead_letter_expired": false}, "other": {"max_delivery_attempts": 3}}
+			}
+		}
+	}`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for consumer, expected := range map[Consumer]bool{"off": false, "other": true, "q": true} {
+		if got := config.Options("q", consumer).DeadLettersExpired(); got != expected {
+			t.Fatalf("consumer %s: expected %v, got %v", consumer, expected, got)
+		}
+	}
+	if config.Options("other", "").DeadLettersExpired() {
+		t.Fatal("dead-lettering of expired messages is on by default")
+	}
+}
@@ -0,0 +1,224 @@
+package messages
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// listenerGroup holds all the listeners sharing the same consumer name.
+// Listeners inside the group are competing for the messages, so each message is delivered to only one of them.
+type listenerGroup struct {
+	// listeners is never modified in place, changes replace the slice, so snapshots can be used without the lock
+	listeners []*Listener
+	next      int
+	mu        sync.Mutex
+	// dropped counts the new messages left for the redelivery, because the outboxes of the listeners were full
+	dropped atomic.Int64
+}
+
+// snapshot returns the listeners of the group at the moment.
+func (g *listenerGroup) snapshot() []*Listener {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.listeners
+}
+
+// add appends the listener to the group.
+func (g *listenerGroup) add(listener *Listener) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	listeners := make([]*Listener, 0, len(g.listeners)+1)
+	listeners = append(listeners, g.listeners...)
+	g.listeners = append(listeners, listener)
+}
+
+// remove deletes the listener with given id from the group, and reports whether the group is empty now.
+func (g *listenerGroup) remove(id string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	listeners := make([]*Listener, 0, len(g.listeners))
+	for _, l := range g.listeners {
+		if l.ID != id {
+			listeners = append(listeners, l)
+		}
+	}
+	g.listeners = listeners
+	return len(g.listeners) == 0
+}
+
+// pick returns the next listener from the group that has a credit for the message, in a round-robin fashion.
+// It returns nil if all the listeners are busy, along with the listeners that were passed over because of full outboxes.
+func (g *listenerGroup) pick(id string) (*Listener, []*Listener) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var full []*Listener
+	for range g.listeners {
+		if g.next >= len(g.listeners) {
+			g.next = 0
+		}
+		listener := g.listeners[g.next]
+		g.next++
+		if listener.reserve(id, false) {
+			return listener, full
+		}
+		if listener.full() {
+			full = append(full, listener)
+		}
+	}
+	return nil, full
+}
+
+// credits returns the number of messages the group can receive at the moment.
+func (g *listenerGroup) credits() int {
+	total := 0
+	for _, listener := range g.snapshot() {
+		total += listener.credits()
+	}
+	return total
+}
+
+// consumerKey identifies the group of listeners of given queue + consumer combination.
+type consumerKey struct {
+	queue    Queue
+	consumer Consumer
+}
+
+// listenerRegistry keeps track of the listeners connected to every queue + consumer combination.
+// It's safe for concurrent use, and the groups it returns are safe to use after the registry has changed.
+type listenerRegistry struct {
+	groups map[Queue]map[Consumer]*listenerGroup
+	// redeliveries make sure that concurrent redeliveries don't compete for the same messages
+	// They are kept apart from the groups, which are replaced once they become empty
+	redeliveries map[consumerKey]*sync.Mutex
+	mu           sync.RWMutex
+}
+
+func newListenerRegistry() *listenerRegistry {
+	return &listenerRegistry{
+		groups:       make(map[Queue]map[Consumer]*listenerGroup),
+		redeliveries: make(map[consumerKey]*sync.Mutex),
+	}
+}
+
+// add registers the listener in the group of its consumer, creating the group if needed.
+func (r *listenerRegistry) add(listener *Listener) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	groups, ok := r.groups[listener.Queue]
+	if !ok {
+		groups = make(map[Consumer]*listenerGroup)
+		r.groups[listener.Queue] = groups
+	}
+	group, ok := groups[listener.Consumer]
+	if !ok {
+		group = &listenerGroup{}
+		groups[listener.Consumer] = group
+	}
+	group.add(listener)
+}
+
+// remove unregisters the listener, dropping its group once it's empty.
+func (r *listenerRegistry) remove(listener *Listener) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	groups, ok := r.groups[listener.Queue]
+	if !ok {
+		return
+	}
+	group, ok := groups[listener.Consumer]
+	if !ok {
+		return
+	}
+	if !group.remove(listener.ID) {
+		return
+	}
+
+	delete(groups, listener.Consumer)
+	if len(groups) == 0 {
+		delete(r.groups, listener.Queue)
+	}
+}
+
+// removeAll unregisters all the listeners of given queue, or only of given consumer if it's not empty,
+// and returns them.
+func (r *listenerRegistry) removeAll(queue Queue, consumer Consumer) []*Listener {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := []*Listener{}
+	for c, group := range r.groups[queue] {
+		if consumer != "" && c != consumer {
+			continue
+		}
+		removed = append(removed, group.snapshot()...)
+		delete(r.groups[queue], c)
+	}
+	if len(r.groups[queue]) == 0 {
+		delete(r.groups, queue)
+	}
+	return removed
+}
+
+// redelivery returns the lock serializing the redeliveries of given queue + consumer combination.
+func (r *listenerRegistry) redelivery(queue Queue, consumer Consumer) *sync.Mutex {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := consumerKey{queue, consumer}
+	mu, ok := r.redeliveries[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		r.redeliveries[key] = mu
+	}
+	return mu
+}
+
+// group returns the group of listeners of given queue + consumer combination.
+func (r *listenerRegistry) group(queue Queue, consumer Consumer) (*listenerGroup, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	group, ok := r.groups[queue][consumer]
+	return group, ok
+}
+
+// queueGroups returns the groups of listeners of every consumer of given queue.
+func (r *listenerRegistry) queueGroups(queue Queue) []*listenerGroup {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make([]*listenerGroup, 0, len(r.groups[queue]))
+	for _, group := range r.groups[queue] {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// keys returns all the queue + consumer combinations that have listeners connected.
+func (r *listenerRegistry) keys() []consumerKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []consumerKey{}
+	for queue, groups := range r.groups {
+		for consumer := range groups {
+			keys = append(keys, consumerKey{queue, consumer})
+		}
+	}
+	return keys
+}
+
+// count returns the number of listeners connected for given queue + consumer combination.
+func (r *listenerRegistry) count(queue Queue, consumer Consumer) int {
+	group, ok := r.group(queue, consumer)
+	if !ok {
+		return 0
+	}
+	return len(group.snapshot())
+}
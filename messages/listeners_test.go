@@ -0,0 +1,208 @@
+package messages
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	pb "github.com/tobias-piotr/leshy/proto"
+)
+
+// newTestListener returns a listener with an outbox, as if it was connected by the broadcaster.
+func newTestListener(queue Queue, consumer Consumer) *Listener {
+	listener := NewListener(queue, consumer)
+	listener.Chan = make(chan *pb.MessageStreamResponse, 10)
+	return listener
+}
+
+func TestListenerGroupRemoveKeepsSnapshots(t *testing.T) {
+	group := &listenerGroup{}
+	listeners := []*Listener{newTestListener("q", "c"), newTestListener("q", "c"), newTestListener("q", "c")}
+	for _, listener := range listeners {
+		group.add(listener)
+	}
+
+	snapshot := group.snapshot()
+	if group.remove(listeners[0].ID) {
+		t.Fatal("group reported empty with two listeners left")
+	}
+
+	// Removing from the group must not shift the listeners of a snapshot taken before
+	for i, listener := range snapshot {
+		if listener != listeners[i] {
+			t.Fatalf("snapshot[%d] changed after remove", i)
+		}
+	}
+	got := group.snapshot()
+	if len(got) != 2 || got[0] != listeners[1] || got[1] != listeners[2] {
+		t.Fatalf("unexpected listeners after remove: %v", got)
+	}
+	if group.remove(listeners[1].ID) {
+		t.Fatal("group reported empty with one listener left")
+	}
+	if !group.remove(listeners[2].ID) {
+		t.Fatal("group not reported empty after removing the last listener")
+	}
+}
+
+func TestListenerGroupPickRoundRobin(t *testing.T) {
+	group := &listenerGroup{}
+	a, b := newTestListener("q", "c"), newTestListener("q", "c")
+	group.add(a)
+	group.add(b)
+
+	picked := map[*Listener]int{}
+	for i := 0; i < 10; i++ {
+		listener, _ := group.pick(fmt.Sprint(i))
+		picked[listener]++
+	}
+	if picked[a] != 5 || picked[b] != 5 {
+		t.Fatalf("messages not spread evenly: a=%d b=%d", picked[a], picked[b])
+	}
+}
+
+func TestListenerRegistryConcurrent(t *testing.T) {
+	registry := newListenerRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			listener := newTestListener("q", Consumer(fmt.Sprint("c", i%5)))
+			for j := 0; j < 200; j++ {
+				registry.add(listener)
+				for _, group := range registry.queueGroups("q") {
+					if picked, _ := group.pick(fmt.Sprint(j)); picked != nil && picked.Queue != "q" {
+						t.Errorf("picked listener of queue %q", picked.Queue)
+					}
+					group.credits()
+				}
+				registry.keys()
+				registry.count("q", listener.Consumer)
+				registry.remove(listener)
+				if j%50 == 0 {
+					registry.removeAll("q", listener.Consumer)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if keys := registry.keys(); len(keys) != 0 {
+		t.Fatalf("registry not empty after all listeners were removed: %v", keys)
+	}
+}
+
+func TestListenerRegistryRemoveAll(t *testing.T) {
+	registry := newListenerRegistry()
+	a, b, c := newTestListener("q", "a"), newTestListener("q", "b"), newTestListener("other", "a")
+	for _, listener := range []*Listener{a, b, c} {
+		registry.add(listener)
+	}
+
+	removed := registry.removeAll("q", "a")
+	if len(removed) != 1 || removed[0] != a {
+		t.Fatalf("unexpected listeners removed: %v", removed)
+	}
+	if registry.count("q", "a") != 0 || registry.count("q", "b") != 1 || registry.count("other", "a") != 1 {
+		t.Fatal("removeAll touched other consumers")
+	}
+
+	removed = registry.removeAll("q", "")
+	if len(removed) != 1 || removed[0] != b {
+		t.Fatalf("unexpected listeners removed: %v", removed)
+	}
+	if len(registry.keys()) != 1 {
+		t.Fatalf("unexpected groups left: %v", registry.keys())
+	}
+}
+
+func TestPublishWhileUnsubscribing(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	const (
+		workers   = 20
+		rounds    = 30
+		consumers = 4
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			consumer := Consumer(fmt.Sprint("c", i%consumers))
+			for j := 0; j < rounds; j++ {
+				listener := NewListener("q", consumer)
+				err := mb.ReadMessages(listener)
+				if err != nil {
+					t.Errorf("reading messages: %v", err)
+					return
+				}
+				go func() {
+					for {
+						select {
+						case <-listener.Chan:
+						case <-listener.Done():
+							return
+						}
+					}
+				}()
+
+				_, err = mb.PublishMessage(&pb.MessageRequest{Queue: "q", Data: []byte("x")})
+				if err != nil {
+					t.Errorf("publishing message: %v", err)
+				}
+				mb.RemoveListener(listener)
+				if j%10 == 0 {
+					mb.disconnect("q", consumer)
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				mb.redeliver()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < consumers; i++ {
+		consumer := Consumer(fmt.Sprint("c", i))
+		if n := mb.listenerCount("q", consumer); n != 0 {
+			t.Fatalf("%d listeners of %s left after unsubscribing", n, consumer)
+		}
+		stats, err := mb.storage.Stats("q", consumer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Every message is kept for every consumer, whether it was delivered or not
+		if total := stats.Pending + stats.InFlight + stats.Acked; total != workers*rounds {
+			t.Fatalf("consumer %s has %d messages, expected %d", consumer, total, workers*rounds)
+		}
+	}
+}
+
+func TestRedeliveryOutlivesGroup(t *testing.T) {
+	registry := newListenerRegistry()
+	listener := newTestListener("q", "c")
+	registry.add(listener)
+	group, _ := registry.group("q", "c")
+	redelivery := registry.redelivery("q", "c")
+
+	// The group is dropped once it's empty, and a new one is created for the next listener
+	registry.remove(listener)
+	registry.add(newTestListener("q", "c"))
+	if replaced, _ := registry.group("q", "c"); replaced == group {
+		t.Fatal("group was not replaced")
+	}
+	if registry.redelivery("q", "c") != redelivery {
+		t.Fatal("redeliveries of the replaced group are not serialized")
+	}
+	if registry.redelivery("q", "other") == redelivery {
+		t.Fatal("redeliveries of different consumers share the lock")
+	}
+}
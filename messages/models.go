@@ -1,8 +1,159 @@
 package messages
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Headers are additional attributes of the message, stored as JSON in the database.
+type Headers map[string]string
+
+func (h Headers) Value() (driver.Value, error) {
+	if len(h) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling headers: %w", err)
+	}
+	return string(b), nil
+}
+
+func (h *Headers) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("unsupported headers type: %T", src)
+	}
+	return json.Unmarshal(b, h)
+}
+
 // Message is a representation of the message that will be retrieved from the database,
 // and sent to the final consumer.
 type Message struct {
+	ID               string
+	CreatedAt        time.Time
+	Data             []byte
+	Headers          Headers
+	DeliveryAttempts int
+	LastError        string
+	// Priority decides the delivery order, messages with higher priority are delivered first
+	Priority int
+	// DeliverAt is set only for scheduled messages, that can't be delivered earlier
+	DeliverAt time.Time
+	// ExpiresAt is set only for messages, that can't be delivered after it
+	ExpiresAt time.Time
+	Acked     bool
+	// VisibleAt is set only for delivered messages, and tells when the lease ends
+	VisibleAt time.Time
+	// DeadLetter is set only for messages that were moved to a dead-letter queue
+	DeadLetter *DeadLetter
+}
+
+// expired checks if the message expired before given time.
+func (m Message) expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !m.ExpiresAt.After(now)
+}
+
+// DeadLetter describes where the dead-lettered message came from, and why it ended up in the dead-letter queue.
+type DeadLetter struct {
+	ID               string
+	Queue            Queue
+	Consumer         Consumer
+	DeliveryAttempts int
+	Reason           string
+}
+
+// DeadLetterFilter narrows down the dead-lettered messages. Empty filter matches all of them.
+type DeadLetterFilter struct {
+	// IDs of the messages in the dead-letter queue
+	IDs      []string
+	Consumer Consumer
+	// Reason matches messages, which failure reason contains it
+	Reason string
+	Limit  int
+}
+
+// MessageStatus narrows down the browsed messages by their acked status.
+type MessageStatus int
+
+const (
+	StatusAll MessageStatus = iota
+	StatusPending
+	StatusAcked
+)
+
+// BrowseFilter narrows down and pages the browsed messages.
+type BrowseFilter struct {
+	Status MessageStatus
+	// After is the cursor returned with the previous page, zero starts from the beginning
+	After int64
+	Limit int
+}
+
+// StartKind tells where a new consumer starts reading the queue.
+type StartKind int
+
+const (
+	// StartEarliest delivers all the messages that are still in the queue
+	StartEarliest StartKind = iota
+	// StartLatest delivers only the messages published after the consumer was created
+	StartLatest
+	// StartTimestamp delivers the messages published at or after given time
+	StartTimestamp
+	// StartMessage delivers the messages published since given message, including it
+	StartMessage
+)
+
+// StartPosition describes where a new consumer starts reading the queue. Zero value starts from the earliest message.
+type StartPosition struct {
+	Kind StartKind
+	Time time.Time
 	ID   string
-	Data []byte
+}
+
+// Retention describes which messages of the consumer are removed by the cleaner. Zero values mean no limit.
+type Retention struct {
+	// AckedMaxAge is how long the acked messages are kept after they were published
+	AckedMaxAge time.Duration
+	// UnackedMaxAge is how long the messages are kept, even if they were never acked
+	UnackedMaxAge time.Duration
+	// MaxMessages is how many messages are kept, the oldest ones are removed first
+	MaxMessages int
+	// MaxBytes is how many bytes of data and headers are kept, the oldest messages are removed first
+	MaxBytes int64
+}
+
+// AtLeast returns the retention which keeps the messages at least for given age.
+func (r Retention) AtLeast(age time.Duration) Retention {
+	if r.AckedMaxAge != 0 {
+		r.AckedMaxAge = max(r.AckedMaxAge, age)
+	}
+	if r.UnackedMaxAge != 0 {
+		r.UnackedMaxAge = max(r.UnackedMaxAge, age)
+	}
+	return r
+}
+
+// ConsumerStats describes the state of messages for specific queue + consumer combination.
+type ConsumerStats struct {
+	Consumer Consumer
+	// Pending messages are waiting to be delivered
+	Pending int
+	// Scheduled messages can't be delivered yet
+	Scheduled int
+	// InFlight messages are leased, and waiting for an ack
+	InFlight int
+	Acked    int
+	// OldestUnacked is the creation time of the oldest message that is not acked, zero if there is none
+	OldestUnacked time.Time
 }
@@ -1,13 +1,32 @@
 package messages
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	pb "github.com/tobias-piotr/leshy/proto"
 )
 
+var defaultRedeliveryInterval = 1 * time.Second
+
+// defaultOutboxBlockTimeout limits how long the publisher waits for the room in the outbox of a listener
+var defaultOutboxBlockTimeout = 5 * time.Second
+
+// outboxBlockedReason is recorded for the messages, that were released because they couldn't be put in the outbox
+const outboxBlockedReason = "listener outbox blocked"
+
+// ErrMessageExists is returned when publishing a message with an id that was used outside of the dedup window.
+var ErrMessageExists = errors.New("message with given id already exists")
+
+// ErrInvalidIDs is returned when acking without the ids of the messages, or with an empty one.
+var ErrInvalidIDs = errors.New("message ids must not be empty")
+
 type (
 	Queue    string
 	Consumer string
@@ -18,94 +37,829 @@ type Listener struct {
 	ID       string
 	Queue    Queue
 	Consumer Consumer
-	Chan     chan *pb.MessageStreamResponse
+	// Chan is the outbox of the listener, it's created when the listener starts reading messages
+	Chan chan *pb.MessageStreamResponse
+	// VisibilityTimeout overrides the visibility timeout of the queue, if set
+	VisibilityTimeout time.Duration
+	// Prefetch limits how many unacked messages the listener can hold at once, zero means no limit
+	Prefetch int
+	// Start is where the consumer starts reading the queue, used only if the consumer is new
+	Start StartPosition
+	// OutboxSize overrides the outbox size of the queue, if set
+	OutboxSize int
+	// OutboxPolicy overrides the outbox policy of the queue, if set
+	OutboxPolicy OutboxPolicy
+
+	// inflight holds lease expiration times of unacked messages sent to the listener
+	inflight map[string]time.Time
+	// queued is the number of messages that have the room reserved in the outbox, but are not there yet
+	queued int
+	mu     sync.Mutex
+	// done is closed when the listener is removed from the broadcaster
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func NewListener(queue Queue, consumer Consumer) *Listener {
+	// Default consumer to queue name (main), same as the storage does
+	if consumer == "" {
+		consumer = Consumer(queue)
+	}
 	return &Listener{
-		uuid.New().String(),
-		queue,
-		consumer,
-		make(chan *pb.MessageStreamResponse),
+		ID:       uuid.New().String(),
+		Queue:    queue,
+		Consumer: consumer,
+		inflight: make(map[string]time.Time),
+		done:     make(chan struct{}),
+	}
+}
+
+// NewStartPosition converts the start position from the request, nil means the earliest message.
+func NewStartPosition(start *pb.StartPosition) StartPosition {
+	switch pos := start.GetPosition().(type) {
+	case *pb.StartPosition_At:
+		if pos.At == pb.StartAt_START_AT_LATEST {
+			return StartPosition{Kind: StartLatest}
+		}
+	case *pb.StartPosition_Timestamp:
+		return StartPosition{Kind: StartTimestamp, Time: pos.Timestamp.AsTime()}
+	case *pb.StartPosition_MessageId:
+		return StartPosition{Kind: StartMessage, ID: pos.MessageId}
+	}
+	return StartPosition{}
+}
+
+// Done returns a channel, that is closed when the listener is removed from the broadcaster,
+// e.g. because its consumer was deleted, or its outbox was full.
+func (l *Listener) Done() <-chan struct{} {
+	return l.done
+}
+
+// close marks the listener as disconnected.
+func (l *Listener) close() {
+	l.closeOnce.Do(func() { close(l.done) })
+}
+
+// reserve takes a credit and the room in the outbox for the message, reporting false if the listener has no credits left,
+// or no room in the outbox, unless overflow is set.
+// Credits taken by messages, which leases expired, are given back.
+func (l *Listener) reserve(id string, overflow bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !overflow && l.room() <= 0 {
+		return false
+	}
+	if l.Prefetch != 0 {
+		now := time.Now()
+		for inflightID, expiresAt := range l.inflight {
+			if !expiresAt.After(now) {
+				delete(l.inflight, inflightID)
+			}
+		}
+		if len(l.inflight) >= l.Prefetch {
+			return false
+		}
+		l.inflight[id] = now.Add(l.VisibilityTimeout)
+	}
+	l.queued++
+	return true
+}
+
+// dequeue gives back the room reserved in the outbox for given number of messages,
+// once they are put in the outbox, or won't be put there at all.
+func (l *Listener) dequeue(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.queued -= n
+}
+
+// full reports whether there is no room left in the outbox.
+func (l *Listener) full() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.room() <= 0
+}
+
+// room returns how many more messages fit in the outbox, the mutex has to be held.
+func (l *Listener) room() int {
+	return cap(l.Chan) - len(l.Chan) - l.queued
+}
+
+// release gives back the credit taken by the message, and reports whether there was one.
+func (l *Listener) release(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.inflight[id]
+	delete(l.inflight, id)
+	return ok
+}
+
+// credits returns the number of messages the listener can receive at the moment,
+// limited by its prefetch and the room left in its outbox.
+func (l *Listener) credits() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	room := max(l.room(), 0)
+	if l.Prefetch == 0 {
+		return room
 	}
+
+	now := time.Now()
+	inflight := 0
+	for _, expiresAt := range l.inflight {
+		if expiresAt.After(now) {
+			inflight++
+		}
+	}
+	return min(max(l.Prefetch-inflight, 0), room)
 }
 
 // MessageBroadcaster is managing messages persistance and delivery to current listeners.
 type MessageBroadcaster struct {
-	storage   *DistributedSQLStorage
-	listeners map[Queue][]*Listener
+	storage   Storage
+	config    *Config
+	listeners *listenerRegistry
+	// waiters are closed when messages are published, to wake up the receivers waiting for them
+	waiters map[Queue]chan struct{}
+	mu      sync.Mutex
 }
 
-func NewMessageBroadcaster(storage *DistributedSQLStorage) *MessageBroadcaster {
+func NewMessageBroadcaster(storage Storage, config *Config) *MessageBroadcaster {
 	return &MessageBroadcaster{
 		storage:   storage,
-		listeners: make(map[Queue][]*Listener),
+		config:    config,
+		listeners: newListenerRegistry(),
+		waiters:   make(map[Queue]chan struct{}),
 	}
 }
 
-// PublishMessage saves the message in a proper database and sends it to all listener channels.
+// Start periodically delivers messages that became available:
+// scheduled messages that are due, and messages which leases expired without an ack.
+func (mb *MessageBroadcaster) Start(ctx context.Context) error {
+	ticker := time.NewTicker(defaultRedeliveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			mb.redeliver()
+		}
+	}
+}
+
+// PublishMessage saves the message in a proper database and sends it to one listener of every consumer.
+// When the id is given, and the message was already published within the dedup window, it is not published again.
 func (mb *MessageBroadcaster) PublishMessage(rq *pb.MessageRequest) (*pb.MessageResponse, error) {
-	id := uuid.New().String()
-	queue := Queue(rq.Queue)
+	ids, err := mb.publishRequests([]*pb.MessageRequest{rq})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.MessageResponse{Id: ids[0]}, nil
+}
 
-	err := mb.storage.Insert(queue, id, rq.Data)
+// PublishMessages works like PublishMessage, but saves all the messages of each queue at once.
+func (mb *MessageBroadcaster) PublishMessages(rq *pb.MessagesRequest) (*pb.MessagesResponse, error) {
+	ids, err := mb.publishRequests(rq.GetMessages())
 	if err != nil {
-		return nil, fmt.Errorf("saving message: %w", err)
+		return nil, err
 	}
+	return &pb.MessagesResponse{Ids: ids}, nil
+}
 
-	listeners, ok := mb.listeners[queue]
-	if ok {
-		go func() {
-			slog.Info("Publishing message to listeners", "id", id, "listeners", len(listeners))
-			for _, listener := range listeners {
-				listener.Chan <- &pb.MessageStreamResponse{Id: id, Data: rq.Data}
+// publishRequests saves the messages from the requests, grouped by queue, and delivers the new ones.
+// Returned ids are in the same order as the requests.
+func (mb *MessageBroadcaster) publishRequests(rqs []*pb.MessageRequest) ([]string, error) {
+	ids := make([]string, len(rqs))
+	// Duplicates are saved as well, because previous publish might have failed in the middle
+	inserts := make(map[Queue][]Message)
+
+	for i, rq := range rqs {
+		queue := Queue(rq.GetQueue())
+		msg := newMessage(rq)
+
+		if msg.ID == "" {
+			msg.ID = uuid.New().String()
+		} else {
+			err := mb.checkDedupWindow(queue, msg.ID)
+			if err != nil {
+				return nil, err
 			}
-		}()
+		}
+
+		inserts[queue] = append(inserts[queue], msg)
+		ids[i] = msg.ID
 	}
 
-	return &pb.MessageResponse{Id: id}, nil
+	for queue, msgs := range inserts {
+		err := mb.publish(queue, msgs...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// newMessage creates a message from the publish request.
+func newMessage(rq *pb.MessageRequest) Message {
+	msg := Message{
+		ID:       rq.GetId(),
+		Data:     rq.GetData(),
+		Headers:  rq.GetHeaders(),
+		Priority: int(rq.GetPriority()),
+	}
+	switch {
+	case rq.GetDeliverAt() != nil:
+		msg.DeliverAt = rq.GetDeliverAt().AsTime()
+	case rq.GetDelay() != nil:
+		msg.DeliverAt = time.Now().Add(rq.GetDelay().AsDuration())
+	}
+	switch {
+	case rq.GetExpiresAt() != nil:
+		msg.ExpiresAt = rq.GetExpiresAt().AsTime()
+	case rq.GetTtl() != nil:
+		msg.ExpiresAt = time.Now().Add(rq.GetTtl().AsDuration())
+	}
+	return msg
 }
 
-// ReadMessages creates a new listener channel for given queue, and sends unread messages to it.
+// checkDedupWindow fails with ErrMessageExists if the message with given id was published before the dedup window of the queue.
+// Publishes within the window are not rejected here, the insert tells which of them saved the message first.
+// The message is looked up in the main consumer, see QueueOptions.DedupWindow for how the retention affects it.
+func (mb *MessageBroadcaster) checkDedupWindow(queue Queue, id string) error {
+	msg, err := mb.storage.Get(queue, Consumer(queue), id)
+	if errors.Is(err, ErrMessageNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting message: %w", err)
+	}
+
+	window := mb.config.Options(queue, "").DedupWindow.Duration
+	if time.Since(msg.CreatedAt) > window {
+		return ErrMessageExists
+	}
+
+	return nil
+}
+
+// ReadMessages registers a new listener for given queue, and sends unread messages to it.
+// Listener gets only as many messages as it has credits for, limited by its prefetch and outbox size.
 func (mb *MessageBroadcaster) ReadMessages(listener *Listener) error {
-	slog.Info("Connecting new listener", "id", listener.ID, "queue", listener.Queue)
+	slog.Info("Connecting new listener", "id", listener.ID, "queue", listener.Queue, "consumer", listener.Consumer)
+
+	opts := mb.config.Options(listener.Queue, listener.Consumer)
+	if listener.VisibilityTimeout == 0 {
+		listener.VisibilityTimeout = opts.VisibilityTimeout.Duration
+	}
+	if listener.OutboxSize == 0 {
+		listener.OutboxSize = opts.OutboxSize
+	}
+	if listener.OutboxPolicy == "" {
+		listener.OutboxPolicy = opts.OutboxPolicy
+	}
+	listener.Chan = make(chan *pb.MessageStreamResponse, max(listener.OutboxSize, 1))
 
-	msgs, err := mb.storage.GetAll(listener.Queue, listener.Consumer)
+	err := mb.storage.Subscribe(listener.Queue, listener.Consumer, listener.Start)
+	if err != nil {
+		return fmt.Errorf("subscribing: %w", err)
+	}
+
+	// Don't fetch more than fits in the outbox, the client is not reading it yet
+	msgs, err := mb.storage.GetAll(listener.Queue, listener.Consumer, listener.credits())
 	if err != nil {
 		return fmt.Errorf("getting messages: %w", err)
 	}
+	for i, msg := range msgs {
+		if !listener.reserve(msg.ID, false) {
+			msgs = msgs[:i]
+			break
+		}
+	}
 
-	go func() {
-		slog.Info("Sending messages to new listener", "messages", len(msgs))
-		for _, msg := range msgs {
-			listener.Chan <- &pb.MessageStreamResponse{Id: msg.ID, Data: msg.Data}
+	slog.Info("Sending messages to new listener", "messages", len(msgs))
+	err = mb.deliver(listener, msgs)
+	if err != nil {
+		return fmt.Errorf("delivering messages: %w", err)
+	}
+
+	mb.listeners.add(listener)
+
+	return nil
+}
+
+// Ack updates the ack status of the messages in the database, and gives the credits back to the listener.
+func (mb *MessageBroadcaster) Ack(listener *Listener, ids ...string) error {
+	err := mb.storage.Ack(listener.Queue, listener.Consumer, ids...)
+	if err != nil {
+		return err
+	}
+	mb.release(listener, ids...)
+	return nil
+}
+
+// AckUpTo acks all the messages delivered to the consumer, that were published before the message with given id,
+// including it, and gives the credits back to the listener.
+func (mb *MessageBroadcaster) AckUpTo(listener *Listener, id string) error {
+	ids, err := mb.storage.AckUpTo(listener.Queue, listener.Consumer, id)
+	if err != nil {
+		return err
+	}
+	mb.release(listener, ids...)
+	return nil
+}
+
+// Nack releases the messages, so they are delivered again after the delay.
+// When the delay is not given, retry delay of the queue is used.
+func (mb *MessageBroadcaster) Nack(listener *Listener, delay time.Duration, reason string, ids ...string) error {
+	slog.Info("Messages nacked", "ids", ids, "listener", listener.ID, "reason", reason)
+	err := mb.nack(listener.Queue, listener.Consumer, delay, reason, ids...)
+	if err != nil {
+		return err
+	}
+	mb.release(listener, ids...)
+	return nil
+}
+
+// release gives the credits taken by the messages back to the listener, and sends it more messages if it uses prefetch.
+func (mb *MessageBroadcaster) release(listener *Listener, ids ...string) {
+	released := false
+	for _, id := range ids {
+		if listener.release(id) {
+			released = true
+		}
+	}
+	if released {
+		go mb.redeliverConsumer(listener.Queue, listener.Consumer)
+	}
+}
+
+// ReceiveMessages leases up to max messages for given queue + consumer combination, and returns them.
+// If there are no messages available, it waits for them until the wait timeout passes.
+func (mb *MessageBroadcaster) ReceiveMessages(ctx context.Context, rq *pb.ReceiveRequest) (*pb.ReceiveResponse, error) {
+	queue, consumer := Queue(rq.GetQueue()), Consumer(rq.GetConsumer())
+	if consumer == "" {
+		consumer = Consumer(queue)
+	}
+	limit := max(int(rq.GetMaxMessages()), 1)
+	deadline := time.Now().Add(rq.GetWaitTimeout().AsDuration())
+
+	// Receiving subscribes the consumer, the same way reading the stream does
+	err := mb.storage.Subscribe(queue, consumer, StartPosition{})
+	if err != nil {
+		return nil, fmt.Errorf("subscribing: %w", err)
+	}
+
+	for {
+		// Subscribe before checking the storage, so that no publish is missed in between
+		published := mb.wait(queue)
+
+		msgs, err := mb.storage.GetAll(queue, consumer, limit)
+		if err != nil {
+			return nil, fmt.Errorf("getting messages: %w", err)
+		}
+		leased, err := mb.lease(queue, consumer, rq.GetVisibilityTimeout().AsDuration(), msgs)
+		if err != nil {
+			return nil, fmt.Errorf("leasing messages: %w", err)
 		}
-	}()
 
-	mb.listeners[listener.Queue] = append(mb.listeners[listener.Queue], listener)
+		remaining := time.Until(deadline)
+		if len(leased) != 0 || remaining <= 0 {
+			resp := &pb.ReceiveResponse{Messages: make([]*pb.MessageStreamResponse, len(leased))}
+			for i, msg := range leased {
+				resp.Messages[i] = &pb.MessageStreamResponse{Id: msg.ID, Data: msg.Data, Headers: msg.Headers}
+			}
+			return resp, nil
+		}
+
+		// Scheduled messages and expired leases are not published, so poll for them as well
+		timer := time.NewTimer(min(remaining, defaultRedeliveryInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-published:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// AckMessages acks (or nacks) the messages received with ReceiveMessages.
+// The consumer has to exist, so acking doesn't create it.
+func (mb *MessageBroadcaster) AckMessages(rq *pb.AckRequest) (*pb.AckResponse, error) {
+	queue, consumer := Queue(rq.GetQueue()), Consumer(rq.GetConsumer())
+	if consumer == "" {
+		consumer = Consumer(queue)
+	}
+	if len(rq.GetIds()) == 0 || slices.Contains(rq.GetIds(), "") {
+		return nil, ErrInvalidIDs
+	}
+
+	consumers, err := mb.storage.Consumers(queue)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(consumers, consumer) {
+		return nil, ErrConsumerNotFound
+	}
+
+	if rq.GetKind() == pb.AckKind_ACK_KIND_NACK {
+		err = mb.nack(queue, consumer, rq.GetRequeueDelay().AsDuration(), rq.GetReason(), rq.GetIds()...)
+	} else {
+		err = mb.storage.Ack(queue, consumer, rq.GetIds()...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.AckResponse{}, nil
+}
+
+// nack releases the messages for given queue + consumer combination.
+func (mb *MessageBroadcaster) nack(queue Queue, consumer Consumer, delay time.Duration, reason string, ids ...string) error {
+	if delay == 0 {
+		delay = mb.config.Options(queue, consumer).RetryDelay.Duration
+	}
+
+	err := mb.storage.Nack(queue, consumer, delay, reason, ids...)
+	if err != nil {
+		return err
+	}
+
+	// No need to wait for the next redelivery tick
+	if delay == 0 {
+		go mb.redeliverConsumer(queue, consumer)
+		mb.notify(queue)
+	}
 
 	return nil
 }
 
-// Ack updates the ack status in the database.
-func (mb *MessageBroadcaster) Ack(listener *Listener, id string) error {
-	return mb.storage.Ack(listener.Queue, listener.Consumer, id)
+// wait returns a channel, that is closed when new messages are published to given queue.
+func (mb *MessageBroadcaster) wait(queue Queue) <-chan struct{} {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	ch, ok := mb.waiters[queue]
+	if !ok {
+		ch = make(chan struct{})
+		mb.waiters[queue] = ch
+	}
+	return ch
 }
 
-// RemoveListener removes the listener channel from the list for given queue.
+// notify wakes up everyone waiting for new messages in given queue.
+func (mb *MessageBroadcaster) notify(queue Queue) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	ch, ok := mb.waiters[queue]
+	if !ok {
+		return
+	}
+	close(ch)
+	delete(mb.waiters, queue)
+}
+
+// RemoveListener removes the listener from the group of its consumer, and closes it.
+// Messages leased to the listener will be redelivered to other listeners, once their leases expire.
 func (mb *MessageBroadcaster) RemoveListener(listener *Listener) {
-	listeners, ok := mb.listeners[listener.Queue]
+	mb.listeners.remove(listener)
+	listener.close()
+}
+
+// publish saves the messages in given queue, and delivers the ones that were new to the current listeners.
+// Messages that were already saved, by an earlier or concurrent publish, are delivered by that publish or the redelivery.
+func (mb *MessageBroadcaster) publish(queue Queue, msgs ...Message) error {
+	inserted, err := mb.storage.InsertMany(queue, msgs)
+	if err != nil {
+		return fmt.Errorf("saving messages: %w", err)
+	}
+
+	deliveries := make([]Message, 0, len(inserted))
+	for _, msg := range msgs {
+		if !inserted[msg.ID] {
+			slog.Info("Skipping duplicated message", "id", msg.ID, "queue", queue)
+			continue
+		}
+		// The same id might be repeated in the batch
+		delete(inserted, msg.ID)
+		deliveries = append(deliveries, msg)
+	}
+	mb.deliverNew(queue, deliveries)
+
+	return nil
+}
+
+// disconnect removes all the listeners of given queue, or only of given consumer if it's not empty, and closes them.
+func (mb *MessageBroadcaster) disconnect(queue Queue, consumer Consumer) {
+	for _, listener := range mb.listeners.removeAll(queue, consumer) {
+		slog.Info("Disconnecting listener", "id", listener.ID, "queue", queue, "consumer", listener.Consumer)
+		listener.close()
+	}
+}
+
+// outboxStats returns the number of messages waiting in the outboxes of the listeners of given queue + consumer combination,
+// and the number of new messages that were left for the redelivery, because the outboxes were full.
+func (mb *MessageBroadcaster) outboxStats(queue Queue, consumer Consumer) (int, int) {
+	group, ok := mb.listeners.group(queue, consumer)
 	if !ok {
+		return 0, 0
+	}
+
+	depth := 0
+	for _, listener := range group.snapshot() {
+		depth += len(listener.Chan)
+	}
+	return depth, int(group.dropped.Load())
+}
+
+// listenerCount returns the number of listeners connected for given queue + consumer combination.
+func (mb *MessageBroadcaster) listenerCount(queue Queue, consumer Consumer) int {
+	return mb.listeners.count(queue, consumer)
+}
+
+// deliverNew sends freshly saved messages to one listener of every consumer, the ones with higher priority first.
+// Scheduled messages are skipped, and delivered by the redelivery once they are due.
+func (mb *MessageBroadcaster) deliverNew(queue Queue, msgs []Message) {
+	now := time.Now()
+	due := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.DeliverAt.After(now) {
+			slog.Info("Scheduled message for later delivery", "id", msg.ID, "deliver_at", msg.DeliverAt)
+			continue
+		}
+		if msg.expired(now) {
+			continue
+		}
+		due = append(due, msg)
+	}
+	if len(due) == 0 {
 		return
 	}
-	if len(listeners) == 1 {
-		delete(mb.listeners, listener.Queue)
+	mb.notify(queue)
+
+	// Listeners might have credits for only some of the messages, so the order is the same as GetAll uses
+	slices.SortStableFunc(due, func(a, b Message) int { return b.Priority - a.Priority })
+
+	// Pick the listeners upfront, so that the round-robin is not affected by the deliveries
+	// Messages that no listener has a credit for, are delivered once the credits are given back
+	batches := make(map[*Listener][]Message)
+	for _, group := range mb.listeners.queueGroups(queue) {
+		for i, msg := range due {
+			listener, full := mb.pickNew(group, msg.ID)
+			if listener == nil {
+				if full {
+					group.dropped.Add(int64(len(due) - i))
+				}
+				break
+			}
+			batches[listener] = append(batches[listener], msg)
+		}
+	}
+
+	if len(batches) != 0 {
+		slog.Info("Publishing messages to listeners", "queue", queue, "messages", len(due), "listeners", len(batches))
+	}
+	for listener, batch := range batches {
+		err := mb.deliver(listener, batch)
+		if err != nil {
+			// The messages are already saved, so they will be picked up by the redelivery
+			slog.Error("Error delivering messages", "listener", listener.ID, "error", err)
+		}
+	}
+}
+
+// deadLetter moves the message from given queue + consumer combination to the dead-letter queue.
+// The message is claimed first, so when it's dead-lettered concurrently, only one copy ends up in the dead-letter queue.
+func (mb *MessageBroadcaster) deadLetter(queue Queue, consumer Consumer, msg Message) error {
+	claimed, err := mb.storage.Claim(queue, consumer, msg.ID)
+	if err != nil {
+		return fmt.Errorf("claiming message: %w", err)
+	}
+	if !claimed {
+		return nil
+	}
+
+	dlq := mb.config.DeadLetterQueue(queue, consumer)
+	slog.Warn("Moving message to dead-letter queue", "id", msg.ID, "queue", queue, "consumer", consumer, "dlq", dlq)
+
+	err = mb.publish(dlq, Message{
+		ID:       uuid.New().String(),
+		Data:     msg.Data,
+		Headers:  msg.Headers,
+		Priority: msg.Priority,
+		DeadLetter: &DeadLetter{
+			ID:               msg.ID,
+			Queue:            queue,
+			Consumer:         consumer,
+			DeliveryAttempts: msg.DeliveryAttempts,
+			Reason:           msg.LastError,
+		},
+	})
+	if err != nil {
+		// Delivery attempts start over, but the message is not lost
+		if err := mb.storage.Requeue(queue, consumer, msg); err != nil {
+			slog.Error("Error requeueing message", "id", msg.ID, "queue", queue, "consumer", consumer, "error", err)
+		}
+		return fmt.Errorf("publishing to dead-letter queue: %w", err)
+	}
+
+	return nil
+}
+
+// deliver leases the messages to the listener, and puts the ones that were successfully leased in its outbox.
+// Credits reserved for the messages that were not leased, or could not be put in the outbox, are given back.
+func (mb *MessageBroadcaster) deliver(listener *Listener, msgs []Message) error {
+	defer listener.dequeue(len(msgs))
+
+	leased, err := mb.lease(listener.Queue, listener.Consumer, listener.VisibilityTimeout, msgs)
+	if err != nil {
+		for _, msg := range msgs {
+			listener.release(msg.ID)
+		}
+		return err
+	}
+
+	leasedIDs := make(map[string]bool, len(leased))
+	for _, msg := range leased {
+		leasedIDs[msg.ID] = true
+	}
+	for _, msg := range msgs {
+		if !leasedIDs[msg.ID] {
+			listener.release(msg.ID)
+		}
+	}
+
+	for i, msg := range leased {
+		if mb.send(listener, msg) {
+			continue
+		}
+
+		// Give the messages that were not sent to other listeners, without waiting for the leases to expire
+		ids := make([]string, 0, len(leased)-i)
+		for _, msg := range leased[i:] {
+			listener.release(msg.ID)
+			ids = append(ids, msg.ID)
+		}
+		slog.Warn("Listener outbox is blocked", "listener", listener.ID, "messages", len(ids))
+
+		err := mb.storage.Nack(listener.Queue, listener.Consumer, 0, outboxBlockedReason, ids...)
+		if err != nil {
+			return fmt.Errorf("releasing messages: %w", err)
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// send puts the message in the outbox of the listener, and reports whether it was put there.
+// The room in the outbox is reserved upfront, so it waits only for the listeners that let the publisher wait,
+// until the listener is removed, or the wait times out.
+func (mb *MessageBroadcaster) send(listener *Listener, msg Message) bool {
+	resp := &pb.MessageStreamResponse{Id: msg.ID, Data: msg.Data, Headers: msg.Headers}
+	select {
+	case listener.Chan <- resp:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(defaultOutboxBlockTimeout)
+	defer timer.Stop()
+	select {
+	case listener.Chan <- resp:
+		return true
+	case <-listener.Done():
+		return false
+	case <-timer.C:
+		return false
+	}
+}
+
+// pickNew returns the listener from the group for a freshly published message, and reports whether
+// there were listeners with full outboxes passed over. Their outbox policy decides what happens:
+// the ones that block get the message anyway, the ones that disconnect are removed,
+// and otherwise the message is left for the redelivery.
+func (mb *MessageBroadcaster) pickNew(group *listenerGroup, id string) (*Listener, bool) {
+	listener, full := group.pick(id)
+	var blocking *Listener
+	for _, l := range full {
+		switch l.OutboxPolicy {
+		case OutboxDisconnect:
+			slog.Warn("Disconnecting slow listener", "id", l.ID, "queue", l.Queue, "consumer", l.Consumer)
+			mb.RemoveListener(l)
+		case OutboxBlock:
+			if listener == nil && blocking == nil && l.reserve(id, true) {
+				blocking = l
+			}
+		}
+	}
+	if listener != nil {
+		return listener, false
+	}
+	return blocking, len(full) != 0
+}
+
+// lease leases the messages for given queue + consumer combination, and returns the ones that were successfully leased.
+// Messages that reached max delivery attempts are moved to the dead-letter queue instead.
+// When the timeout is not given, visibility timeout of the queue is used.
+func (mb *MessageBroadcaster) lease(queue Queue, consumer Consumer, timeout time.Duration, msgs []Message) ([]Message, error) {
+	opts := mb.config.Options(queue, consumer)
+	if timeout == 0 {
+		timeout = opts.VisibilityTimeout.Duration
+	}
+
+	candidates := make([]Message, 0, len(msgs))
+	ids := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		if opts.MaxDeliveryAttempts > 0 && msg.DeliveryAttempts >= opts.MaxDeliveryAttempts {
+			err := mb.deadLetter(queue, consumer, msg)
+			if err != nil {
+				return nil, fmt.Errorf("dead-lettering message: %w", err)
+			}
+			continue
+		}
+		candidates = append(candidates, msg)
+		ids = append(ids, msg.ID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	leasedIDs, err := mb.storage.Lease(queue, consumer, ids, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("leasing messages: %w", err)
+	}
+	leased := make([]Message, 0, len(leasedIDs))
+	for _, msg := range candidates {
+		if leasedIDs[msg.ID] {
+			leased = append(leased, msg)
+		}
+	}
+
+	return leased, nil
+}
+
+// redeliver sends the messages that are not leased at the moment to the listeners of every consumer.
+func (mb *MessageBroadcaster) redeliver() {
+	for _, k := range mb.listeners.keys() {
+		mb.redeliverConsumer(k.queue, k.consumer)
+	}
+}
+
+// redeliverConsumer sends the messages that are not leased at the moment to the listeners of given consumer,
+// as long as they have credits for them.
+func (mb *MessageBroadcaster) redeliverConsumer(queue Queue, consumer Consumer) {
+	redelivery := mb.listeners.redelivery(queue, consumer)
+	redelivery.Lock()
+	defer redelivery.Unlock()
+
+	group, ok := mb.listeners.group(queue, consumer)
+	if !ok {
+		return
+	}
+
+	credits := group.credits()
+	if credits == 0 {
+		return
+	}
+
+	msgs, err := mb.storage.GetAll(queue, consumer, credits)
+	if err != nil {
+		slog.Error("Error getting messages to redeliver", "queue", queue, "consumer", consumer, "error", err)
 		return
 	}
+	if len(msgs) == 0 {
+		return
+	}
+
+	// Spread the messages across the listeners
+	// The group might be gone, or changed, since the credits were counted
+	batches := make(map[*Listener][]Message)
+	group, ok = mb.listeners.group(queue, consumer)
+	if ok {
+		for _, msg := range msgs {
+			listener, _ := group.pick(msg.ID)
+			if listener == nil {
+				break
+			}
+			batches[listener] = append(batches[listener], msg)
+		}
+	}
 
-	for i, l := range listeners {
-		if l.ID == listener.ID {
-			mb.listeners[listener.Queue] = append(listeners[:i], listeners[i+1:]...)
+	slog.Info("Redelivering messages", "queue", queue, "consumer", consumer, "messages", len(msgs))
+	for listener, batch := range batches {
+		err := mb.deliver(listener, batch)
+		if err != nil {
+			slog.Error("Error redelivering messages", "listener", listener.ID, "error", err)
 		}
 	}
 }
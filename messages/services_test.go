@@ -0,0 +1,639 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/tobias-piotr/leshy/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// newOutboxBroadcaster returns a broadcaster keeping messages in memory, with given outbox size and policy.
+func newOutboxBroadcaster(size int, policy OutboxPolicy) *MessageBroadcaster {
+	config := NewConfig()
+	config.Defaults.OutboxSize = size
+	config.Defaults.OutboxPolicy = policy
+	return NewMessageBroadcaster(NewMemoryStorage(), config)
+}
+
+func publish(t *testing.T, mb *MessageBroadcaster, queue Queue, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		_, err := mb.PublishMessage(&pb.MessageRequest{Queue: string(queue), Data: []byte(fmt.Sprint(i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func browse(t *testing.T, mb *MessageBroadcaster, queue Queue) []Message {
+	t.Helper()
+	msgs, _, err := mb.storage.Browse(queue, Consumer(queue), BrowseFilter{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+func TestPickSkipsFullOutbox(t *testing.T) {
+	group := &listenerGroup{}
+	slow, idle := NewListener("q", "c"), NewListener("q", "c")
+	slow.Chan = make(chan *pb.MessageStreamResponse, 1)
+	slow.Chan <- &pb.MessageStreamResponse{}
+	idle.Chan = make(chan *pb.MessageStreamResponse, 5)
+	group.add(slow)
+	group.add(idle)
+
+	for i := 0; i < 5; i++ {
+		listener, full := group.pick(fmt.Sprint(i))
+		if listener != idle {
+			t.Fatalf("message %d not picked for the idle listener", i)
+		}
+		if i%2 == 0 && (len(full) != 1 || full[0] != slow) {
+			t.Fatalf("slow listener not reported as full: %v", full)
+		}
+	}
+	if credits := group.credits(); credits != 0 {
+		t.Fatalf("group has %d credits with all outboxes reserved", credits)
+	}
+	if listener, _ := group.pick("x"); listener != nil {
+		t.Fatal("message picked with all outboxes reserved")
+	}
+}
+
+func TestOutboxDropDoesNotCountAttempts(t *testing.T) {
+	mb := newOutboxBroadcaster(2, OutboxDrop)
+	slow, peer := NewListener("q", ""), NewListener("q", "")
+	for _, listener := range []*Listener{slow, peer} {
+		err := mb.ReadMessages(listener)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publish(t, mb, "q", 10)
+	received := len(slow.Chan)
+	for i := 0; i < 10 && received < 10; i++ {
+		for len(peer.Chan) != 0 {
+			<-peer.Chan
+			received++
+		}
+		mb.redeliver()
+	}
+
+	if len(slow.Chan) > 2 {
+		t.Fatalf("slow listener got %d messages with outbox of 2", len(slow.Chan))
+	}
+	if received != 10 {
+		t.Fatalf("received %d messages, expected 10", received)
+	}
+	for _, msg := range browse(t, mb, "q") {
+		if msg.DeliveryAttempts != 1 {
+			t.Fatalf("message %s has %d delivery attempts", msg.ID, msg.DeliveryAttempts)
+		}
+	}
+	if _, dropped := mb.outboxStats("q", "q"); dropped == 0 {
+		t.Fatal("no dropped messages reported")
+	}
+}
+
+func TestOutboxDisconnect(t *testing.T) {
+	mb := newOutboxBroadcaster(1, OutboxDisconnect)
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publish(t, mb, "q", 2)
+
+	select {
+	case <-listener.Done():
+	default:
+		t.Fatal("slow listener was not disconnected")
+	}
+	if n := mb.listenerCount("q", "q"); n != 0 {
+		t.Fatalf("%d listeners left", n)
+	}
+	attempts := 0
+	for _, msg := range browse(t, mb, "q") {
+		attempts += msg.DeliveryAttempts
+	}
+	if attempts != 1 {
+		t.Fatalf("%d delivery attempts counted, expected only the delivered message", attempts)
+	}
+}
+
+func TestOutboxBlock(t *testing.T) {
+	mb := newOutboxBroadcaster(1, OutboxBlock)
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, mb, "q", 1)
+
+	published := make(chan struct{})
+	go func() {
+		_, err := mb.PublishMessage(&pb.MessageRequest{Queue: "q", Data: []byte("x")})
+		if err != nil {
+			t.Error(err)
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("publisher did not wait for the room in the outbox")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	<-listener.Chan
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publisher still waits after the room was made")
+	}
+	if len(listener.Chan) != 1 {
+		t.Fatal("blocked message was not put in the outbox")
+	}
+}
+
+func TestOutboxBlockTimeout(t *testing.T) {
+	timeout := defaultOutboxBlockTimeout
+	defaultOutboxBlockTimeout = 50 * time.Millisecond
+	defer func() { defaultOutboxBlockTimeout = timeout }()
+
+	mb := newOutboxBroadcaster(1, OutboxBlock)
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, mb, "q", 2)
+
+	released := 0
+	for _, msg := range browse(t, mb, "q") {
+		if msg.LastError != outboxBlockedReason {
+			continue
+		}
+		released++
+		if msg.VisibleAt.After(time.Now()) {
+			t.Fatal("blocked message is still leased")
+		}
+	}
+	if released != 1 {
+		t.Fatalf("%d messages released, expected 1", released)
+	}
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	if listener.queued != 0 {
+		t.Fatal("outbox room of the blocked message was not given back")
+	}
+}
+
+func TestConcurrentPublishDeliversOnce(t *testing.T) {
+	mb := newOutboxBroadcaster(100, OutboxDrop)
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := mb.PublishMessage(&pb.MessageRequest{Queue: "q", Id: "same", Data: []byte("x")})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(listener.Chan); n != 1 {
+		t.Fatalf("message delivered %d times", n)
+	}
+}
+
+func TestConcurrentDeadLetterOnce(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	publish(t, mb, "q", 1)
+	msg := browse(t, mb, "q")[0]
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := mb.deadLetter("q", "q", msg)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(browse(t, mb, mb.config.DeadLetterQueue("q", "q"))); n != 1 {
+		t.Fatalf("message dead-lettered %d times", n)
+	}
+}
+
+func TestDeliverNewByPriority(t *testing.T) {
+	mb := newOutboxBroadcaster(2, OutboxDrop)
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rqs := []*pb.MessageRequest{
+		{Queue: "q", Data: []byte("low")},
+		{Queue: "q", Data: []byte("high"), Priority: 5},
+		{Queue: "q", Data: []byte("first"), Priority: 1},
+		{Queue: "q", Data: []byte("second"), Priority: 1},
+	}
+	_, err = mb.PublishMessages(&pb.MessagesRequest{Messages: rqs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for len(listener.Chan) != 0 {
+		got = append(got, string((<-listener.Chan).GetData()))
+	}
+	if fmt.Sprint(got) != "[high first]" {
+		t.Fatalf("unexpected messages delivered: %v", got)
+	}
+}
+
+func TestRedeliverExpiredLease(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	listener := NewListener("q", "")
+	listener.VisibilityTimeout = 50 * time.Millisecond
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, mb, "q", 1)
+	first := <-listener.Chan
+
+	// Not acked before the lease expired
+	time.Sleep(100 * time.Millisecond)
+	mb.redeliver()
+
+	select {
+	case msg := <-listener.Chan:
+		if msg.Id != first.Id {
+			t.Fatalf("expected message %s to be redelivered, got %s", first.Id, msg.Id)
+		}
+	default:
+		t.Fatal("message was not redelivered")
+	}
+	if attempts := browse(t, mb, "q")[0].DeliveryAttempts; attempts != 2 {
+		t.Fatalf("expected 2 delivery attempts, got %d", attempts)
+	}
+}
+
+func TestNackRedeliversWithoutDelay(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, mb, "q", 1)
+	msg := <-listener.Chan
+
+	err = mb.Nack(listener, 0, "retry", msg.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case redelivered := <-listener.Chan:
+		if redelivered.Id != msg.Id {
+			t.Fatalf("expected message %s to be redelivered, got %s", msg.Id, redelivered.Id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nacked message was not redelivered")
+	}
+	if reason := browse(t, mb, "q")[0].LastError; reason != "retry" {
+		t.Fatalf("expected the reason to be recorded, got %q", reason)
+	}
+}
+
+func TestScheduledMessageDeliveredWhenDue(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = mb.PublishMessage(&pb.MessageRequest{Queue: "q", Data: []byte("x"), Schedule: &pb.MessageRequest_Delay{Delay: durationpb.New(200 * time.Millisecond)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listener.Chan) != 0 {
+		t.Fatal("scheduled message pushed before it was due")
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	mb.redeliver()
+	if len(listener.Chan) != 1 {
+		t.Fatal("scheduled message not delivered once it was due")
+	}
+}
+
+func TestHeadersDelivered(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]string{"traceparent": "00-abc-def-01"}
+	_, err = mb.PublishMessage(&pb.MessageRequest{Queue: "q", Data: []byte("x"), Headers: headers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := <-listener.Chan
+	if fmt.Sprint(msg.Headers) != fmt.Sprint(headers) {
+		t.Fatalf("expected headers %v, got %v", headers, msg.Headers)
+	}
+}
+
+func TestPublishMessagesAcrossQueues(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	rqs := []*pb.MessageRequest{
+		{Queue: "a", Data: []byte("1")},
+		{Queue: "b", Data: []byte("2"), Id: "given"},
+		{Queue: "a", Data: []byte("3")},
+		{Queue: "b", Data: []byte("4"), Id: "given"},
+	}
+	resp, err := mb.PublishMessages(&pb.MessagesRequest{Messages: rqs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := resp.GetIds()
+	if len(ids) != len(rqs) || ids[1] != "given" || ids[3] != "given" {
+		t.Fatalf("ids not returned in the order of the requests: %v", ids)
+	}
+	a := browse(t, mb, "a")
+	if len(a) != 2 || a[0].ID != ids[0] || a[1].ID != ids[2] {
+		t.Fatalf("expected messages %v in queue a, got %v", []string{ids[0], ids[2]}, a)
+	}
+	// The repeated id is saved once
+	if b := browse(t, mb, "b"); len(b) != 1 || string(b[0].Data) != "2" {
+		t.Fatalf("expected only the first message with repeated id in queue b, got %v", b)
+	}
+}
+
+func TestReceiveWaitsForPublish(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		publish(t, mb, "q", 1)
+	}()
+
+	start := time.Now()
+	resp, err := mb.ReceiveMessages(context.Background(), &pb.ReceiveRequest{
+		Queue: "q", MaxMessages: 10, WaitTimeout: durationpb.New(5 * time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetMessages()) != 1 {
+		t.Fatalf("expected the published message, got %d messages", len(resp.GetMessages()))
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("receive did not wake up on publish")
+	}
+
+	// Nothing left, so it returns empty once the wait times out
+	resp, err = mb.ReceiveMessages(context.Background(), &pb.ReceiveRequest{Queue: "q", WaitTimeout: durationpb.New(50 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetMessages()) != 0 {
+		t.Fatalf("expected no messages, got %d", len(resp.GetMessages()))
+	}
+}
+
+func TestReceiveLeasesUntilAcked(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	publish(t, mb, "q", 3)
+
+	first, err := mb.ReceiveMessages(context.Background(), &pb.ReceiveRequest{Queue: "q", MaxMessages: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := mb.ReceiveMessages(context.Background(), &pb.ReceiveRequest{Queue: "q", MaxMessages: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.GetMessages()) != 2 || len(second.GetMessages()) != 1 {
+		t.Fatalf("expected leased messages to be received once, got %d and %d", len(first.GetMessages()), len(second.GetMessages()))
+	}
+
+	ids := []string{}
+	for _, msg := range first.GetMessages() {
+		ids = append(ids, msg.GetId())
+	}
+	_, err = mb.AckMessages(&pb.AckRequest{Queue: "q", Ids: ids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := mb.storage.Stats("q", "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Acked != 2 || stats.InFlight != 1 {
+		t.Fatalf("expected 2 acked and 1 in-flight message, got %+v", stats)
+	}
+}
+
+func TestPrefetchLimitsInFlight(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	publish(t, mb, "q", 3)
+	listener := NewListener("q", "")
+	listener.Prefetch = 2
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, mb, "q", 2)
+
+	if n := len(listener.Chan); n != 2 {
+		t.Fatalf("listener got %d messages with prefetch of 2", n)
+	}
+	mb.redeliver()
+	if n := len(listener.Chan); n != 2 {
+		t.Fatalf("listener got %d messages with prefetch of 2, after the redelivery", n)
+	}
+
+	// Every ack gives a credit back, and the next message is sent
+	msg := <-listener.Chan
+	err = mb.Ack(listener, msg.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(time.Second)
+	for len(listener.Chan) != 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("listener has %d messages after the ack, expected 2", len(listener.Chan))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestListConsumersReportsListeners(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	listener := NewListener("q", "worker")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, mb, "q", 2)
+
+	resp, err := NewAdmin(mb).ListConsumers(&pb.ListConsumersRequest{Queue: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stats := range resp.GetConsumers() {
+		if stats.GetConsumer() != "worker" {
+			continue
+		}
+		if stats.GetListeners() != 1 || stats.GetInFlight() != 2 || stats.GetOutboxDepth() != 2 {
+			t.Fatalf("expected 1 listener with 2 messages in flight and in the outbox, got %v", stats)
+		}
+		return
+	}
+	t.Fatalf("worker consumer not listed in %v", resp.GetConsumers())
+}
+
+func TestDeleteConsumerDisconnectsListeners(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	worker, other := NewListener("q", "worker"), NewListener("q", "other")
+	for _, listener := range []*Listener{worker, other} {
+		err := mb.ReadMessages(listener)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := NewAdmin(mb).DeleteConsumer(&pb.DeleteConsumerRequest{Queue: "q", Consumer: "worker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-worker.Done():
+	default:
+		t.Fatal("listener of the deleted consumer was not disconnected")
+	}
+	select {
+	case <-other.Done():
+		t.Fatal("listener of other consumer was disconnected")
+	default:
+	}
+}
+
+func TestBrowseMessagesPageToken(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	publish(t, mb, "q", 3)
+	admin := NewAdmin(mb)
+
+	first, err := admin.BrowseMessages(&pb.BrowseMessagesRequest{Queue: "q", PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.GetMessages()) != 2 || first.GetNextPageToken() == "" {
+		t.Fatalf("expected a full page with the next page token, got %v", first)
+	}
+	second, err := admin.BrowseMessages(&pb.BrowseMessagesRequest{Queue: "q", PageSize: 2, PageToken: first.GetNextPageToken()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.GetMessages()) != 1 || second.GetNextPageToken() != "" {
+		t.Fatalf("expected the last message without the next page token, got %v", second)
+	}
+
+	_, err = admin.BrowseMessages(&pb.BrowseMessagesRequest{Queue: "q", PageToken: "x"})
+	if !errors.Is(err, ErrInvalidPageToken) {
+		t.Fatalf("expected %v, got %v", ErrInvalidPageToken, err)
+	}
+}
+
+func TestSeekConsumerRedelivers(t *testing.T) {
+	mb := NewMessageBroadcaster(NewMemoryStorage(), NewConfig())
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, mb, "q", 1)
+	msg := <-listener.Chan
+	err = mb.Ack(listener, msg.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := NewAdmin(mb).SeekConsumer(&pb.SeekConsumerRequest{Queue: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetReplayed() != 1 {
+		t.Fatalf("expected 1 replayed message, got %d", resp.GetReplayed())
+	}
+	select {
+	case replayed := <-listener.Chan:
+		if replayed.Id != msg.Id {
+			t.Fatalf("expected message %s to be replayed, got %s", msg.Id, replayed.Id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("replayed message was not delivered to the connected listener")
+	}
+}
+
+func TestExpiredMessagesDeadLettered(t *testing.T) {
+	config := NewConfig()
+	on := true
+	config.Queues["q"] = QueueOptions{DeadLetterExpired: &on}
+	mb := NewMessageBroadcaster(NewMemoryStorage(), config)
+	listener := NewListener("q", "")
+	err := mb.ReadMessages(listener)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = mb.PublishMessage(&pb.MessageRequest{Queue: "q", Data: []byte("x"), Expiry: &pb.MessageRequest_ExpiresAt{
+		ExpiresAt: timestamppb.New(time.Now().Add(-time.Second)),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listener.Chan) != 0 {
+		t.Fatal("expired message was pushed")
+	}
+
+	err = NewCleaner(mb).removeExpiredMessages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(browse(t, mb, "q")); n != 0 {
+		t.Fatalf("%d expired messages left", n)
+	}
+	dead := browse(t, mb, mb.config.DeadLetterQueue("q", "q"))
+	if len(dead) != 1 || dead[0].DeadLetter == nil || dead[0].DeadLetter.Reason != expiredReason {
+		t.Fatalf("expected the expired message in the dead-letter queue, got %v", dead)
+	}
+}
@@ -1,9 +1,12 @@
 package messages
 
 import (
+	"cmp"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +16,68 @@ import (
 
 var defaultTTL = 1 * time.Minute
 
+var (
+	// ErrMessageNotFound is returned when there is no message with given id.
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrQueueNotFound is returned when there is no queue with given name.
+	ErrQueueNotFound = errors.New("queue not found")
+	// ErrConsumerNotFound is returned when there is no consumer with given name.
+	ErrConsumerNotFound = errors.New("consumer not found")
+	// ErrMainConsumer is returned when trying to delete the main consumer, without deleting the queue.
+	ErrMainConsumer = errors.New("main consumer can be deleted only with the queue")
+)
+
+// Storage keeps the messages of the queues, together with their delivery state for every consumer.
+// Empty consumer means the main consumer, named the same as the queue.
+type Storage interface {
+	// InsertMany saves the messages for every consumer of the queue, skipping the ones that already exist,
+	// and returns the ids of the messages that were new for the main consumer
+	InsertMany(queue Queue, msgs []Message) (map[string]bool, error)
+	// GetAll retrieves the messages that can be delivered now, ordered by priority and creation time
+	GetAll(queue Queue, consumer Consumer, limit int) ([]Message, error)
+	Get(queue Queue, consumer Consumer, id string) (Message, error)
+	Ack(queue Queue, consumer Consumer, ids ...string) error
+	// Claim acks the message, unless it's already acked, and reports whether it did
+	Claim(queue Queue, consumer Consumer, id string) (bool, error)
+	// AckUpTo acks the delivered messages published before the message with given id, including it
+	AckUpTo(queue Queue, consumer Consumer, id string) ([]string, error)
+	// Nack releases the leases, so the messages are delivered again after given delay
+	Nack(queue Queue, consumer Consumer, delay time.Duration, reason string, ids ...string) error
+	// Lease hides the messages from other listeners for given time, and returns the ids that were leased
+	Lease(queue Queue, consumer Consumer, ids []string, timeout time.Duration) (map[string]bool, error)
+	// Requeue makes the message pending again, as if it was never delivered
+	Requeue(queue Queue, consumer Consumer, msg Message) error
+	// Delete removes the messages for every consumer of the queue
+	Delete(queue Queue, ids []string) error
+	// GetDeadLetters retrieves the dead-lettered messages of the queue, failing with ErrQueueNotFound if it doesn't exist
+	GetDeadLetters(queue Queue, filter DeadLetterFilter) ([]Message, error)
+
+	// Subscribe creates the consumer if it doesn't exist, skipping the messages published before the start position
+	Subscribe(queue Queue, consumer Consumer, start StartPosition) error
+	// Seek moves the existing consumer to given position, and returns how many messages were made pending and acked
+	// Messages published before the consumer was created are replayed as well, when the position is before them
+	Seek(queue Queue, consumer Consumer, pos StartPosition) (int, int, error)
+	// Browse retrieves the messages without leasing them, and returns the cursor for the next page
+	Browse(queue Queue, consumer Consumer, filter BrowseFilter) ([]Message, int64, error)
+	Stats(queue Queue, consumer Consumer) (ConsumerStats, error)
+	Queues() ([]Queue, error)
+	Consumers(queue Queue) ([]Consumer, error)
+	Purge(queue Queue) (map[Consumer]int, error)
+	DeleteConsumer(queue Queue, consumer Consumer) error
+	DeleteQueue(queue Queue) error
+
+	// GetExpired retrieves the unacked messages of the consumer, that expired
+	GetExpired(queue Queue, consumer Consumer, limit int) ([]Message, error)
+	// DeleteExpired removes the expired messages of the consumer, and returns how many were removed
+	DeleteExpired(queue Queue, consumer Consumer) (int, error)
+	// Trim removes the messages of the consumer outside of the retention, and returns how many were removed
+	Trim(queue Queue, consumer Consumer, retention Retention) (int, error)
+	// Vacuum gives back the space of the removed messages
+	Vacuum(queue Queue) error
+	// CloseIdle releases the resources that were not used for a while, and returns how many were released
+	CloseIdle() (int, error)
+}
+
 // Connection represents a database connection, with a life time limit.
 type Connection struct {
 	DB  *sql.DB
@@ -56,9 +121,11 @@ func (m *ConnectionMap) SetMany(queue Queue, conns map[Consumer]*Connection) {
 	}
 }
 
+// Get returns the connection for given queue + consumer combination, and extends its TTL.
+// It takes the write lock, because the TTL is read by Clean.
 func (m *ConnectionMap) Get(queue Queue, consumer Consumer) *Connection {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	queueMap, ok := m.connMap[queue]
 	if !ok {
@@ -68,19 +135,48 @@ func (m *ConnectionMap) Get(queue Queue, consumer Consumer) *Connection {
 	if conn == nil {
 		return nil
 	}
-	// Increase ttl
-	// Technically speaking we are bypassing the write lock,
-	// but this race condition is not dangerous (for now)
 	conn.IncreaseTTL()
 	return conn
 }
 
-func (m *ConnectionMap) Clean() int {
+// Delete removes the connection for given queue + consumer combination from the map, and closes it.
+func (m *ConnectionMap) Delete(queue Queue, consumer Consumer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, ok := m.connMap[queue][consumer]
+	if !ok {
+		return nil
+	}
+	delete(m.connMap[queue], consumer)
+	if len(m.connMap[queue]) == 0 {
+		delete(m.connMap, queue)
+	}
+	return conn.DB.Close()
+}
+
+// DeleteQueue removes all the connections for given queue from the map, and closes them.
+func (m *ConnectionMap) DeleteQueue(queue Queue) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := []error{}
+	for _, conn := range m.connMap[queue] {
+		errs = append(errs, conn.DB.Close())
+	}
+	delete(m.connMap, queue)
+	return errors.Join(errs...)
+}
+
+// Clean removes the connections, that have expired, from the map and closes them.
+// It returns how many were removed, even if closing some of them failed.
+func (m *ConnectionMap) Clean() (int, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	now := time.Now()
 	removedCount := 0
+	errs := []error{}
 
 	for queue, consMap := range m.connMap {
 		for consumer, conn := range consMap {
@@ -88,6 +184,7 @@ func (m *ConnectionMap) Clean() int {
 				continue
 			}
 			removedCount++
+			errs = append(errs, conn.DB.Close())
 			// If there is only one connection, delete the map for the queue
 			if len(consMap) == 1 {
 				delete(m.connMap, queue)
@@ -98,40 +195,276 @@ func (m *ConnectionMap) Clean() int {
 		}
 	}
 
-	return removedCount
+	return removedCount, errors.Join(errs...)
+}
+
+// DistributedSQLStorage keeps a separate SQLite database for every consumer of the queue.
+type DistributedSQLStorage struct {
+	connMap *ConnectionMap
+	// opening makes sure that the database of each consumer is opened, and filled with the messages, only once
+	opening map[consumerKey]*sync.Mutex
+	mu      sync.Mutex
 }
 
-type DistributedSQLStorage struct{ connMap *ConnectionMap }
+var _ Storage = (*DistributedSQLStorage)(nil)
 
 func NewDistributedSQLStorage(connMap *ConnectionMap) *DistributedSQLStorage {
-	return &DistributedSQLStorage{connMap}
+	return &DistributedSQLStorage{connMap: connMap, opening: make(map[consumerKey]*sync.Mutex)}
 }
 
-// Insert saves the message in every database for given queue.
-func (dss *DistributedSQLStorage) Insert(queue Queue, id string, data []byte) error {
+// InsertMany saves the messages in every database for given queue, using a single transaction per database.
+// Messages that already exist in the database are skipped, so the insert can be safely retried.
+// Concurrent inserts of the same message are told apart by the main database, so only one of them reports it as new.
+func (dss *DistributedSQLStorage) InsertMany(queue Queue, msgs []Message) (map[string]bool, error) {
 	conns, err := dss.getQueueConns(queue)
 	if err != nil {
-		return fmt.Errorf("getting queue dbs: %w", err)
+		return nil, fmt.Errorf("getting queue dbs: %w", err)
 	}
 
-	for _, conn := range conns {
-		_, err = conn.DB.Exec("INSERT INTO messages (id, data) VALUES (?, ?);", id, data)
+	inserted := map[string]bool{}
+	for consumer, conn := range conns {
+		ids, err := insertMessages(conn.DB, msgs)
+		if err != nil {
+			return nil, err
+		}
+		if consumer == Consumer(queue) {
+			inserted = ids
+		}
+	}
+
+	return inserted, nil
+}
+
+// GetAll retrieves all the unacked messages for given queue + consumer combination,
+// that are not leased at the moment, and are not scheduled for later.
+// Expired messages are skipped. Messages are ordered by priority, and then by creation time. Limit of 0 means no limit.
+func (dss *DistributedSQLStorage) GetAll(queue Queue, consumer Consumer, limit int) ([]Message, error) {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Negative limit means no limit in SQLite
+	if limit <= 0 {
+		limit = -1
+	}
+
+	now := time.Now().UTC()
+	rows, err := conn.DB.Query(`
+SELECT id, created_at, data, headers, delivery_attempts, COALESCE(last_error, ''), priority FROM messages
+WHERE acked = 0 AND (visible_at IS NULL OR visible_at <= ?) AND (deliver_at IS NULL OR deliver_at <= ?)
+AND (expires_at IS NULL OR expires_at > ?)
+ORDER BY priority DESC, created_at ASC, rowid ASC
+LIMIT ?;`,
+		now, now, now, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs := []Message{}
+	for rows.Next() {
+		var msg Message
+		err = rows.Scan(&msg.ID, &msg.CreatedAt, &msg.Data, &msg.Headers, &msg.DeliveryAttempts, &msg.LastError, &msg.Priority)
+		if err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return msgs, nil
+}
+
+// Get retrieves the message with given id, from database for specific queue + consumer combination.
+func (dss *DistributedSQLStorage) Get(queue Queue, consumer Consumer, id string) (Message, error) {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var msg Message
+	err = conn.DB.QueryRow(`
+SELECT id, created_at, data, headers, delivery_attempts, COALESCE(last_error, ''), priority
+FROM messages WHERE id = ?;`,
+		id,
+	).Scan(&msg.ID, &msg.CreatedAt, &msg.Data, &msg.Headers, &msg.DeliveryAttempts, &msg.LastError, &msg.Priority)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("scanning row: %w", err)
+	}
+
+	return msg, nil
+}
+
+// Ack updates the acked status for messages with given ids, in database for specific queue + consumer combination.
+// All the messages are updated in one transaction.
+func (dss *DistributedSQLStorage) Ack(queue Queue, consumer Consumer, ids ...string) error {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return err
+	}
+
+	err = execForEach(conn.DB, "UPDATE messages SET acked = 1, visible_at = NULL WHERE id = ?;", ids)
+	if err != nil {
+		return fmt.Errorf("updating messages: %w", err)
+	}
+
+	return nil
+}
+
+// Claim acks the message with given id, in database for specific queue + consumer combination,
+// and reports whether it was acked by this call. Only one of concurrent claims of the same message succeeds.
+func (dss *DistributedSQLStorage) Claim(queue Queue, consumer Consumer, id string) (bool, error) {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := conn.DB.Exec("UPDATE messages SET acked = 1, visible_at = NULL WHERE id = ? AND acked = 0;", id)
+	if err != nil {
+		return false, fmt.Errorf("updating message: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("reading affected rows: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// AckUpTo acks all the delivered messages, that were published before the message with given id, including it.
+// It returns the ids of the messages that were acked.
+func (dss *DistributedSQLStorage) AckUpTo(queue Queue, consumer Consumer, id string) ([]string, error) {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.DB.Query(`
+UPDATE messages SET acked = 1, visible_at = NULL
+WHERE acked = 0 AND delivery_attempts > 0 AND rowid <= (SELECT rowid FROM messages WHERE id = ?)
+RETURNING id;`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("updating messages: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
 		if err != nil {
-			return fmt.Errorf("inserting message: %w", err)
+			return nil, fmt.Errorf("scanning row: %w", err)
 		}
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return ids, nil
+}
+
+// Nack releases the leases of the messages, so they will be delivered again after given delay, and records the reason.
+// All the messages are updated in one transaction.
+func (dss *DistributedSQLStorage) Nack(queue Queue, consumer Consumer, delay time.Duration, reason string, ids ...string) error {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return err
+	}
+
+	err = execForEach(
+		conn.DB,
+		"UPDATE messages SET visible_at = ?, last_error = ? WHERE acked = 0 AND id = ?;",
+		ids,
+		time.Now().UTC().Add(delay), reason,
+	)
+	if err != nil {
+		return fmt.Errorf("updating messages: %w", err)
 	}
 
 	return nil
 }
 
-// GetAll retrieves all the messages for given queue + consumer combination.
-func (dss *DistributedSQLStorage) GetAll(queue Queue, consumer Consumer) ([]Message, error) {
+// Lease hides the messages from other listeners of the consumer for given amount of time, and counts the delivery attempt.
+// It returns the ids of leased messages, skipping the ones that are already acked, leased by someone else, scheduled for later,
+// or expired.
+func (dss *DistributedSQLStorage) Lease(queue Queue, consumer Consumer, ids []string, timeout time.Duration) (map[string]bool, error) {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+UPDATE messages SET visible_at = ?, delivery_attempts = delivery_attempts + 1
+WHERE id = ? AND acked = 0 AND (visible_at IS NULL OR visible_at <= ?) AND (deliver_at IS NULL OR deliver_at <= ?)
+AND (expires_at IS NULL OR expires_at > ?);`)
+	if err != nil {
+		return nil, fmt.Errorf("preparing statement: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	leased := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		res, err := stmt.Exec(now.Add(timeout), id, now, now, now)
+		if err != nil {
+			return nil, fmt.Errorf("updating message: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("reading affected rows: %w", err)
+		}
+		if n == 1 {
+			leased[id] = true
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return leased, nil
+}
+
+// GetExpired retrieves the unacked messages, that expired, from database for specific queue + consumer combination.
+func (dss *DistributedSQLStorage) GetExpired(queue Queue, consumer Consumer, limit int) ([]Message, error) {
 	conn, err := dss.getConsumerConn(queue, consumer)
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := conn.DB.Query("SELECT id, data FROM messages WHERE acked = 0 ORDER BY created_at ASC;")
+	// Negative limit means no limit in SQLite
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := conn.DB.Query(`
+SELECT id, created_at, data, headers, delivery_attempts, priority, expires_at FROM messages
+WHERE acked = 0 AND expires_at <= ?
+ORDER BY rowid ASC
+LIMIT ?;`,
+		time.Now().UTC(), limit,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("querying messages: %w", err)
 	}
@@ -140,7 +473,105 @@ func (dss *DistributedSQLStorage) GetAll(queue Queue, consumer Consumer) ([]Mess
 	msgs := []Message{}
 	for rows.Next() {
 		var msg Message
-		err = rows.Scan(&msg.ID, &msg.Data)
+		err = rows.Scan(&msg.ID, &msg.CreatedAt, &msg.Data, &msg.Headers, &msg.DeliveryAttempts, &msg.Priority, &msg.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return msgs, nil
+}
+
+// DeleteExpired removes the expired messages from database for specific queue + consumer combination.
+func (dss *DistributedSQLStorage) DeleteExpired(queue Queue, consumer Consumer) (int, error) {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := conn.DB.Exec("DELETE FROM messages WHERE expires_at <= ?;", time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("deleting messages: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("reading affected rows: %w", err)
+	}
+	return int(n), nil
+}
+
+// GetDeadLetters retrieves the dead-lettered messages from given (dead-letter) queue, that match the filter.
+// The queue is not created, if it doesn't exist.
+func (dss *DistributedSQLStorage) GetDeadLetters(queue Queue, filter DeadLetterFilter) ([]Message, error) {
+	queues, err := dss.Queues()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(queues, queue) {
+		return nil, ErrQueueNotFound
+	}
+
+	conn, err := dss.getConsumerConn(queue, Consumer(queue))
+	if err != nil {
+		return nil, err
+	}
+
+	return queryDeadLetters(conn.DB, filter)
+}
+
+// queryDeadLetters selects the dead-lettered messages, that match the filter.
+func queryDeadLetters(db *sql.DB, filter DeadLetterFilter) ([]Message, error) {
+	query := `
+SELECT id, created_at, data, headers, priority, source_id, source_queue, source_consumer, source_attempts, COALESCE(source_error, '')
+FROM messages WHERE source_id IS NOT NULL`
+	args := []any{}
+	if len(filter.IDs) != 0 {
+		query += fmt.Sprintf(" AND id IN (?%s)", strings.Repeat(", ?", len(filter.IDs)-1))
+		for _, id := range filter.IDs {
+			args = append(args, id)
+		}
+	}
+	if filter.Consumer != "" {
+		query += " AND source_consumer = ?"
+		args = append(args, filter.Consumer)
+	}
+	if filter.Reason != "" {
+		query += " AND instr(source_error, ?) > 0"
+		args = append(args, filter.Reason)
+	}
+	query += " ORDER BY created_at ASC, rowid ASC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs := []Message{}
+	for rows.Next() {
+		msg := Message{DeadLetter: &DeadLetter{}}
+		err = rows.Scan(
+			&msg.ID,
+			&msg.CreatedAt,
+			&msg.Data,
+			&msg.Headers,
+			&msg.Priority,
+			&msg.DeadLetter.ID,
+			&msg.DeadLetter.Queue,
+			&msg.DeadLetter.Consumer,
+			&msg.DeadLetter.DeliveryAttempts,
+			&msg.DeadLetter.Reason,
+		)
 		if err != nil {
 			return nil, fmt.Errorf("scanning row: %w", err)
 		}
@@ -155,111 +586,2581 @@ func (dss *DistributedSQLStorage) GetAll(queue Queue, consumer Consumer) ([]Mess
 	return msgs, nil
 }
 
-// Ack updates the acked status for message with given id, in database for specific queue + consumer combination.
-func (dss *DistributedSQLStorage) Ack(queue Queue, consumer Consumer, id string) error {
+// Requeue makes the message pending again for specific queue + consumer combination, as if it was never delivered.
+// If the message is missing in the consumer database, it is inserted.
+func (dss *DistributedSQLStorage) Requeue(queue Queue, consumer Consumer, msg Message) error {
 	conn, err := dss.getConsumerConn(queue, consumer)
 	if err != nil {
 		return err
 	}
 
-	_, err = conn.DB.Exec("UPDATE messages SET acked = 1 WHERE id = ?;", id)
+	_, err = conn.DB.Exec(`
+INSERT INTO messages (id, data, headers, priority) VALUES (?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET acked = 0, visible_at = NULL, delivery_attempts = 0, last_error = NULL;`,
+		msg.ID, msg.Data, msg.Headers, msg.Priority,
+	)
 	if err != nil {
-		return fmt.Errorf("updating message: %w", err)
+		return fmt.Errorf("upserting message: %w", err)
 	}
 
 	return nil
 }
 
-// getQueueDBs gets connection for each database (consumer) for given queue.
-func (dss *DistributedSQLStorage) getQueueConns(queue Queue) (map[Consumer]*Connection, error) {
-	// Get filenames for given queue
-	filenames, err := sqlite.GetDBFilenames(string(queue))
+// Delete removes the messages with given ids from every database for given queue.
+func (dss *DistributedSQLStorage) Delete(queue Queue, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	conns, err := dss.getQueueConns(queue)
 	if err != nil {
-		return nil, fmt.Errorf("reading filenames: %w", err)
+		return fmt.Errorf("getting queue dbs: %w", err)
 	}
 
-	// If there are no files, it means it is a new queue
-	if len(filenames) == 0 {
-		filenames = append(filenames, string(queue))
+	query := fmt.Sprintf("DELETE FROM messages WHERE id IN (?%s);", strings.Repeat(", ?", len(ids)-1))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
 	}
 
-	// Get connection for each file
-	// If connection is present in the map, use it
-	conns := make(map[Consumer]*Connection, len(filenames))
-	for _, f := range filenames {
-		dbName := strings.Split(f, ".db")[0]
-		// TODO: Maybe would also make sense to GetMany
-		conn := dss.connMap.Get(queue, Consumer(dbName))
-		if conn == nil {
-			db, err := sqlite.GetDB(string(queue), dbName, false)
-			if err != nil {
-				return nil, fmt.Errorf("getting db: %w", err)
-			}
-			ttl := time.Now().Add(defaultTTL)
-			conn = &Connection{db, ttl}
+	for _, conn := range conns {
+		_, err = conn.DB.Exec(query, args...)
+		if err != nil {
+			return fmt.Errorf("deleting messages: %w", err)
 		}
-		conns[Consumer(dbName)] = conn
 	}
-	// TODO: Potential unnecessary assignments, because some connections might already be there (retrieved by Get)
-	dss.connMap.SetMany(queue, conns)
 
-	return conns, nil
+	return nil
 }
 
-func (dss *DistributedSQLStorage) getConsumerConn(queue Queue, consumer Consumer) (*Connection, error) {
-	// Default consumer to queue name (main)
-	if consumer == "" {
-		consumer = Consumer(queue)
+// Queues returns the names of all the queues.
+func (dss *DistributedSQLStorage) Queues() ([]Queue, error) {
+	dirnames, err := sqlite.GetDirNames()
+	if err != nil {
+		return nil, fmt.Errorf("reading dirnames: %w", err)
 	}
 
-	// Get preused connection
-	conn := dss.connMap.Get(queue, consumer)
-	if conn != nil {
-		return conn, nil
+	queues := make([]Queue, len(dirnames))
+	for i, d := range dirnames {
+		queues[i] = Queue(d)
 	}
+	return queues, nil
+}
 
-	// Get a new consumer connection
-	db, err := sqlite.GetDB(string(queue), string(consumer), true)
+// Consumers returns the names of all the consumers (databases) of given queue, including the main one.
+func (dss *DistributedSQLStorage) Consumers(queue Queue) ([]Consumer, error) {
+	queues, err := dss.Queues()
 	if err != nil {
-		return nil, fmt.Errorf("getting db: %w", err)
+		return nil, err
+	}
+	if !slices.Contains(queues, queue) {
+		return nil, ErrQueueNotFound
 	}
-	ttl := time.Now().Add(defaultTTL)
-	conn = &Connection{db, ttl}
-	dss.connMap.Set(queue, consumer, conn)
 
-	// If this is a main connection, then no need to do anything else
-	if consumer == Consumer(queue) {
-		return conn, nil
+	filenames, err := sqlite.GetDBFilenames(string(queue))
+	if err != nil {
+		return nil, fmt.Errorf("reading filenames: %w", err)
+	}
+
+	consumers := []Consumer{}
+	for _, f := range filenames {
+		// Skip journals and other files SQLite keeps next to the databases
+		name, ok := strings.CutSuffix(f, ".db")
+		if !ok {
+			continue
+		}
+		consumers = append(consumers, Consumer(name))
+	}
+	return consumers, nil
+}
+
+// Stats counts the messages in every state, in database for specific queue + consumer combination.
+func (dss *DistributedSQLStorage) Stats(queue Queue, consumer Consumer) (ConsumerStats, error) {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return ConsumerStats{}, err
+	}
+
+	stats := ConsumerStats{Consumer: consumer}
+	var oldest sql.NullString
+	now := time.Now().UTC()
+	err = conn.DB.QueryRow(`
+SELECT
+	COALESCE(SUM(acked = 0 AND deliver_at > ?), 0),
+	COALESCE(SUM(acked = 0 AND visible_at > ?), 0),
+	COALESCE(SUM(acked = 1), 0),
+	COALESCE(SUM(acked = 0), 0),
+	MIN(CASE WHEN acked = 0 THEN created_at END)
+FROM messages;`,
+		now, now,
+	).Scan(&stats.Scheduled, &stats.InFlight, &stats.Acked, &stats.Pending, &oldest)
+	if err != nil {
+		return ConsumerStats{}, fmt.Errorf("scanning row: %w", err)
 	}
+	stats.Pending -= stats.Scheduled + stats.InFlight
 
-	// Get main connection, and save it in the map
-	mainConn := dss.connMap.Get(queue, Consumer(queue))
-	if mainConn == nil {
-		db, err := sqlite.GetDB(string(queue), string(queue), false)
+	if oldest.Valid {
+		stats.OldestUnacked, err = time.Parse(time.DateTime, oldest.String)
 		if err != nil {
-			return nil, fmt.Errorf("getting main db: %w", err)
+			return ConsumerStats{}, fmt.Errorf("parsing created at: %w", err)
 		}
-		mainConn = &Connection{db, ttl}
-		dss.connMap.Set(queue, Consumer(queue), mainConn)
 	}
 
-	// Check if consumer db is empty
-	row := db.QueryRow("SELECT 1 FROM messages LIMIT 1")
-	var v int
-	err = row.Scan(&v)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return nil, fmt.Errorf("scanning row: %w", err)
+	return stats, nil
+}
+
+// Browse retrieves the messages for given queue + consumer combination, in the order they were saved,
+// without leasing them. It returns the cursor for the next page, which is zero when there are no more messages.
+func (dss *DistributedSQLStorage) Browse(queue Queue, consumer Consumer, filter BrowseFilter) ([]Message, int64, error) {
+	// Don't create the database for a consumer that never read anything
+	consumers, err := dss.Consumers(queue)
+	if err != nil {
+		return nil, 0, err
 	}
-	// If not, then consumer db is good to go
-	if v == 1 {
-		return conn, nil
+	if !slices.Contains(consumers, consumer) {
+		return nil, 0, ErrConsumerNotFound
 	}
 
-	// If consumer is empty, then it's (most likely) new, so we copy data from main
-	err = sqlite.CopyDB(mainConn.DB, string(queue), string(consumer))
+	conn, err := dss.getConsumerConn(queue, consumer)
 	if err != nil {
-		return nil, fmt.Errorf("copying main to consumer: %w", err)
+		return nil, 0, err
 	}
 
-	return conn, nil
+	query := `
+SELECT rowid, id, created_at, data, headers, delivery_attempts, COALESCE(last_error, ''), priority, deliver_at, acked, visible_at
+FROM messages WHERE rowid > ?`
+	switch filter.Status {
+	case StatusPending:
+		query += " AND acked = 0"
+	case StatusAcked:
+		query += " AND acked = 1"
+	}
+	// Fetch one more message, to know if there is a next page
+	query += " ORDER BY rowid ASC LIMIT ?;"
+
+	rows, err := conn.DB.Query(query, filter.After, filter.Limit+1)
+	if err != nil {
+		return nil, 0, fmt.Errorf("querying messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs := []Message{}
+	cursors := []int64{}
+	for rows.Next() {
+		var msg Message
+		var cursor int64
+		var deliverAt, visibleAt sql.NullTime
+		err = rows.Scan(
+			&cursor,
+			&msg.ID,
+			&msg.CreatedAt,
+			&msg.Data,
+			&msg.Headers,
+			&msg.DeliveryAttempts,
+			&msg.LastError,
+			&msg.Priority,
+			&deliverAt,
+			&msg.Acked,
+			&visibleAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scanning row: %w", err)
+		}
+		msg.DeliverAt = deliverAt.Time
+		msg.VisibleAt = visibleAt.Time
+		msgs = append(msgs, msg)
+		cursors = append(cursors, cursor)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading rows: %w", err)
+	}
+
+	if len(msgs) <= filter.Limit {
+		return msgs, 0, nil
+	}
+	return msgs[:filter.Limit], cursors[filter.Limit-1], nil
+}
+
+// Subscribe makes sure that the database for given queue + consumer combination exists.
+// If the consumer is new, only the messages published since the start position are copied from main,
+// so the ones before are never delivered to it. Start position of existing consumers is ignored.
+func (dss *DistributedSQLStorage) Subscribe(queue Queue, consumer Consumer, start StartPosition) error {
+	_, err := dss.openConsumerConn(queue, consumer, start)
+	return err
+}
+
+// Seek moves the consumer to given position, in one transaction. Messages published before it are marked as acked,
+// and the acked messages published since it are made pending again, as if they were never delivered.
+// Messages that were not copied from main, because the consumer was created at a later position, are copied first.
+// It returns how many messages were made pending, and how many were acked.
+func (dss *DistributedSQLStorage) Seek(queue Queue, consumer Consumer, pos StartPosition) (int, int, error) {
+	consumers, err := dss.Consumers(queue)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !slices.Contains(consumers, consumer) {
+		return 0, 0, ErrConsumerNotFound
+	}
+
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if consumer != Consumer(queue) {
+		err = dss.backfill(queue, conn, pos)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	before, args, err := beforePosition(conn.DB, pos)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(fmt.Sprintf(`
+UPDATE messages SET acked = 0, visible_at = NULL, delivery_attempts = 0, last_error = NULL
+WHERE acked = 1 AND NOT (%s);`, before),
+		args...,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("updating messages: %w", err)
+	}
+	replayed, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading affected rows: %w", err)
+	}
+
+	res, err = tx.Exec(fmt.Sprintf("UPDATE messages SET acked = 1, visible_at = NULL WHERE acked = 0 AND %s;", before), args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("updating messages: %w", err)
+	}
+	skipped, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading affected rows: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return int(replayed), int(skipped), nil
+}
+
+// backfill copies the messages since given position, that are missing in the database of the consumer, from main.
+// They are copied as acked, so Seek replays them together with the rest.
+func (dss *DistributedSQLStorage) backfill(queue Queue, conn *Connection, pos StartPosition) error {
+	mainConn, err := dss.getConsumerConn(queue, Consumer(queue))
+	if err != nil {
+		return err
+	}
+
+	before, args, err := beforePosition(mainConn.DB, pos)
+	// The consumer might still have the message, that was already removed from main
+	if errors.Is(err, ErrMessageNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = sqlite.BackfillDB(conn.DB, string(queue), string(queue), "NOT ("+before+")", args...)
+	if err != nil {
+		return fmt.Errorf("copying main to consumer: %w", err)
+	}
+	return nil
+}
+
+// Purge removes all the messages from every database for given queue, and returns how many were removed.
+func (dss *DistributedSQLStorage) Purge(queue Queue) (map[Consumer]int, error) {
+	queues, err := dss.Queues()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(queues, queue) {
+		return nil, ErrQueueNotFound
+	}
+
+	conns, err := dss.getQueueConns(queue)
+	if err != nil {
+		return nil, fmt.Errorf("getting queue dbs: %w", err)
+	}
+
+	removed := make(map[Consumer]int, len(conns))
+	for consumer, conn := range conns {
+		res, err := conn.DB.Exec("DELETE FROM messages;")
+		if err != nil {
+			return nil, fmt.Errorf("deleting messages: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("reading affected rows: %w", err)
+		}
+		removed[consumer] = int(n)
+	}
+
+	return removed, nil
+}
+
+// DeleteConsumer closes the connection, and removes the database for given queue + consumer combination.
+// Main consumer can't be deleted, because new consumers are copied from it.
+func (dss *DistributedSQLStorage) DeleteConsumer(queue Queue, consumer Consumer) error {
+	if consumer == Consumer(queue) {
+		return ErrMainConsumer
+	}
+
+	consumers, err := dss.Consumers(queue)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(consumers, consumer) {
+		return ErrConsumerNotFound
+	}
+
+	err = dss.connMap.Delete(queue, consumer)
+	if err != nil {
+		return fmt.Errorf("closing connection: %w", err)
+	}
+
+	err = sqlite.RemoveDB(string(queue), string(consumer))
+	if err != nil {
+		return fmt.Errorf("removing db: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteQueue closes all the connections, and removes all the databases for given queue.
+func (dss *DistributedSQLStorage) DeleteQueue(queue Queue) error {
+	queues, err := dss.Queues()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(queues, queue) {
+		return ErrQueueNotFound
+	}
+
+	err = dss.connMap.DeleteQueue(queue)
+	if err != nil {
+		return fmt.Errorf("closing connections: %w", err)
+	}
+
+	err = sqlite.RemoveDir(string(queue))
+	if err != nil {
+		return fmt.Errorf("removing dir: %w", err)
+	}
+
+	return nil
+}
+
+// Trim removes the messages outside of the retention from the database of the consumer, in one transaction.
+func (dss *DistributedSQLStorage) Trim(queue Queue, consumer Consumer, retention Retention) (int, error) {
+	conn, err := dss.getConsumerConn(queue, consumer)
+	if err != nil {
+		return 0, err
+	}
+
+	return trimMessages(conn.DB, retention, trimLayout{acked: "acked = 1", unacked: "acked = 0", seq: "rowid"})
+}
+
+// Vacuum gives back the space of the removed messages, in every database of the queue.
+func (dss *DistributedSQLStorage) Vacuum(queue Queue) error {
+	conns, err := dss.getQueueConns(queue)
+	if err != nil {
+		return fmt.Errorf("getting queue dbs: %w", err)
+	}
+
+	for _, conn := range conns {
+		err = sqlite.Vacuum(conn.DB)
+		if err != nil {
+			return fmt.Errorf("vacuuming db: %w", err)
+		}
+	}
+	return nil
+}
+
+// CloseIdle removes the connections that were not used for a while.
+func (dss *DistributedSQLStorage) CloseIdle() (int, error) {
+	return dss.connMap.Clean()
+}
+
+// trimLayout describes how trimMessages matches the messages, in the database layout of the storage.
+type trimLayout struct {
+	// acked and unacked are the conditions matching acked and unacked messages
+	acked, unacked string
+	// args are the arguments of the acked and unacked conditions
+	args []any
+	// seq is the column, that orders the messages from the oldest
+	seq string
+	// cleanup is executed after the messages are removed, if it's set
+	cleanup string
+}
+
+// trimMessages removes the messages outside of the retention, in one transaction.
+func trimMessages(db *sql.DB, retention Retention, layout trimLayout) (int, error) {
+	type deletion struct {
+		query string
+		args  []any
+	}
+
+	now := time.Now().UTC()
+	deletions := []deletion{}
+	// created_at is stored with second precision, in the same format as time.DateTime
+	if retention.AckedMaxAge > 0 {
+		deletions = append(deletions, deletion{
+			fmt.Sprintf("DELETE FROM messages WHERE %s AND created_at < ?;", layout.acked),
+			append(slices.Clone(layout.args), now.Add(-retention.AckedMaxAge).Format(time.DateTime)),
+		})
+	}
+	if retention.UnackedMaxAge > 0 {
+		deletions = append(deletions, deletion{
+			fmt.Sprintf("DELETE FROM messages WHERE %s AND created_at < ?;", layout.unacked),
+			append(slices.Clone(layout.args), now.Add(-retention.UnackedMaxAge).Format(time.DateTime)),
+		})
+	}
+	if retention.MaxMessages > 0 {
+		deletions = append(deletions, deletion{
+			fmt.Sprintf("DELETE FROM messages WHERE %[1]s NOT IN (SELECT %[1]s FROM messages ORDER BY %[1]s DESC LIMIT ?);", layout.seq),
+			[]any{retention.MaxMessages},
+		})
+	}
+	if retention.MaxBytes > 0 {
+		deletions = append(deletions, deletion{
+			fmt.Sprintf(`
+DELETE FROM messages WHERE %[1]s IN (
+	SELECT %[1]s FROM (
+		SELECT %[1]s, SUM(COALESCE(LENGTH(data), 0) + COALESCE(LENGTH(headers), 0)) OVER (ORDER BY %[1]s DESC) AS total
+		FROM messages
+	)
+	WHERE total > ?
+);`,
+				layout.seq,
+			),
+			[]any{retention.MaxBytes},
+		})
+	}
+	if len(deletions) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	removed := 0
+	for _, d := range deletions {
+		res, err := tx.Exec(d.query, d.args...)
+		if err != nil {
+			return 0, fmt.Errorf("deleting messages: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("reading affected rows: %w", err)
+		}
+		removed += int(n)
+	}
+
+	if layout.cleanup != "" {
+		_, err = tx.Exec(layout.cleanup)
+		if err != nil {
+			return 0, fmt.Errorf("cleaning up: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return removed, nil
+}
+
+// execForEach executes the statement once for every id, in one transaction.
+// The id is passed after all the other arguments.
+func execForEach(db *sql.DB, query string, ids []string, args ...any) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("preparing statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, id := range ids {
+		_, err = stmt.Exec(append(args, id)...)
+		if err != nil {
+			return fmt.Errorf("executing statement: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertMessages saves the messages in the database, in one transaction, and returns the ids of the ones that were new.
+func insertMessages(db *sql.DB, msgs []Message) (map[string]bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+INSERT INTO messages (
+	id, data, headers, deliver_at, expires_at, priority, source_id, source_queue, source_consumer, source_attempts, source_error
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO NOTHING;`)
+	if err != nil {
+		return nil, fmt.Errorf("preparing statement: %w", err)
+	}
+	defer stmt.Close()
+
+	inserted := make(map[string]bool, len(msgs))
+	for _, msg := range msgs {
+		var source struct {
+			id, queue, consumer, reason sql.NullString
+			attempts                    sql.NullInt64
+		}
+		if msg.DeadLetter != nil {
+			source.id = sql.NullString{String: msg.DeadLetter.ID, Valid: true}
+			source.queue = sql.NullString{String: string(msg.DeadLetter.Queue), Valid: true}
+			source.consumer = sql.NullString{String: string(msg.DeadLetter.Consumer), Valid: true}
+			source.attempts = sql.NullInt64{Int64: int64(msg.DeadLetter.DeliveryAttempts), Valid: true}
+			source.reason = sql.NullString{String: msg.DeadLetter.Reason, Valid: true}
+		}
+
+		var deliverAt, expiresAt sql.NullTime
+		if !msg.DeliverAt.IsZero() {
+			deliverAt = sql.NullTime{Time: msg.DeliverAt.UTC(), Valid: true}
+		}
+		if !msg.ExpiresAt.IsZero() {
+			expiresAt = sql.NullTime{Time: msg.ExpiresAt.UTC(), Valid: true}
+		}
+
+		res, err := stmt.Exec(
+			msg.ID, msg.Data, msg.Headers, deliverAt, expiresAt, msg.Priority,
+			source.id, source.queue, source.consumer, source.attempts, source.reason,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("inserting message: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("reading affected rows: %w", err)
+		}
+		if n == 1 {
+			inserted[msg.ID] = true
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return inserted, nil
+}
+
+// getQueueDBs gets connection for each database (consumer) for given queue.
+func (dss *DistributedSQLStorage) getQueueConns(queue Queue) (map[Consumer]*Connection, error) {
+	// Get filenames for given queue
+	filenames, err := sqlite.GetDBFilenames(string(queue))
+	if err != nil {
+		return nil, fmt.Errorf("reading filenames: %w", err)
+	}
+
+	// If there are no files, it means it is a new queue
+	if len(filenames) == 0 {
+		filenames = append(filenames, string(queue))
+	}
+
+	// Get connection for each file
+	// If connection is present in the map, use it
+	conns := make(map[Consumer]*Connection, len(filenames))
+	for _, f := range filenames {
+		consumer := Consumer(strings.Split(f, ".db")[0])
+		if _, ok := conns[consumer]; ok {
+			continue
+		}
+		conn, err := dss.queueConn(queue, consumer)
+		if err != nil {
+			return nil, err
+		}
+		if conn != nil {
+			conns[consumer] = conn
+		}
+	}
+
+	return conns, nil
+}
+
+// openingLock returns the lock, that is held while the database of given queue + consumer combination is opened.
+func (dss *DistributedSQLStorage) openingLock(queue Queue, consumer Consumer) *sync.Mutex {
+	dss.mu.Lock()
+	defer dss.mu.Unlock()
+
+	key := consumerKey{queue, consumer}
+	mu, ok := dss.opening[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		dss.opening[key] = mu
+	}
+	return mu
+}
+
+// queueConn gets the connection for the database of given consumer, that was found in the directory of the queue.
+// It waits for the consumer, that is being created, and returns nil if its database was removed in the meantime.
+func (dss *DistributedSQLStorage) queueConn(queue Queue, consumer Consumer) (*Connection, error) {
+	conn := dss.connMap.Get(queue, consumer)
+	if conn != nil {
+		return conn, nil
+	}
+
+	lock := dss.openingLock(queue, consumer)
+	lock.Lock()
+	defer lock.Unlock()
+
+	conn = dss.connMap.Get(queue, consumer)
+	if conn != nil {
+		return conn, nil
+	}
+	if consumer != Consumer(queue) {
+		exists, err := sqlite.DBExists(string(queue), string(consumer))
+		if err != nil {
+			return nil, fmt.Errorf("checking db: %w", err)
+		}
+		if !exists {
+			return nil, nil
+		}
+	}
+
+	db, err := sqlite.GetDB(string(queue), string(consumer), true)
+	if err != nil {
+		return nil, fmt.Errorf("getting db: %w", err)
+	}
+	conn = &Connection{db, time.Now().Add(defaultTTL)}
+	dss.connMap.Set(queue, consumer, conn)
+	return conn, nil
+}
+
+func (dss *DistributedSQLStorage) getConsumerConn(queue Queue, consumer Consumer) (*Connection, error) {
+	return dss.openConsumerConn(queue, consumer, StartPosition{})
+}
+
+// openConsumerConn gets the connection for given queue + consumer combination,
+// and if the consumer is new, copies the messages from main, starting from given position.
+// The connection is put in the map only once the messages are copied, so no one else sees a partial copy.
+func (dss *DistributedSQLStorage) openConsumerConn(queue Queue, consumer Consumer, start StartPosition) (*Connection, error) {
+	// Default consumer to queue name (main)
+	if consumer == "" {
+		consumer = Consumer(queue)
+	}
+
+	// Get preused connection
+	conn := dss.connMap.Get(queue, consumer)
+	if conn != nil {
+		return conn, nil
+	}
+
+	// Concurrent callers wait for the first one, and use its connection
+	lock := dss.openingLock(queue, consumer)
+	lock.Lock()
+	defer lock.Unlock()
+
+	conn = dss.connMap.Get(queue, consumer)
+	if conn != nil {
+		return conn, nil
+	}
+
+	// Retention can remove all the messages of the consumer, so only a missing database means a new consumer
+	exists, err := sqlite.DBExists(string(queue), string(consumer))
+	if err != nil {
+		return nil, fmt.Errorf("checking db: %w", err)
+	}
+
+	// Get a new consumer connection
+	db, err := sqlite.GetDB(string(queue), string(consumer), true)
+	if err != nil {
+		return nil, fmt.Errorf("getting db: %w", err)
+	}
+
+	// If consumer is new, we copy data from main, but only since the start position
+	if consumer != Consumer(queue) && !exists {
+		err = dss.copyMain(queue, consumer, start)
+		if err != nil {
+			// Let the next call copy the messages again, instead of using a partial copy
+			removeErr := errors.Join(db.Close(), sqlite.RemoveDB(string(queue), string(consumer)))
+			if removeErr != nil {
+				return nil, fmt.Errorf("removing partial copy: %w", errors.Join(err, removeErr))
+			}
+			return nil, fmt.Errorf("copying main to consumer: %w", err)
+		}
+	}
+
+	conn = &Connection{db, time.Now().Add(defaultTTL)}
+	dss.connMap.Set(queue, consumer, conn)
+	return conn, nil
+}
+
+// copyMain copies the messages published since the start position from main to the database of the consumer.
+func (dss *DistributedSQLStorage) copyMain(queue Queue, consumer Consumer, start StartPosition) error {
+	mainConn, err := dss.getConsumerConn(queue, Consumer(queue))
+	if err != nil {
+		return err
+	}
+
+	before, args, err := beforePosition(mainConn.DB, start)
+	if err != nil {
+		return err
+	}
+	return sqlite.CopyDB(mainConn.DB, string(queue), string(consumer), "NOT ("+before+")", args...)
+}
+
+// beforePosition returns the condition, that matches the messages published before the position.
+func beforePosition(db *sql.DB, pos StartPosition) (string, []any, error) {
+	switch pos.Kind {
+	case StartLatest:
+		return "1", nil, nil
+	case StartTimestamp:
+		// created_at is stored with second precision, in the same format as time.DateTime
+		return "created_at < ?", []any{pos.Time.UTC().Format(time.DateTime)}, nil
+	case StartMessage:
+		var rowid int64
+		err := db.QueryRow("SELECT rowid FROM messages WHERE id = ?;", pos.ID).Scan(&rowid)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, ErrMessageNotFound
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("scanning row: %w", err)
+		}
+		return "rowid < ?", []any{rowid}, nil
+	}
+	return "0", nil, nil
+}
+
+// MemoryStorage keeps the messages in memory, with a separate copy of every message for each consumer,
+// the same way as DistributedSQLStorage does. Nothing is written to disk, so the messages are lost on restart.
+type MemoryStorage struct {
+	queues map[Queue]map[Consumer]*memoryConsumer
+	// seq orders the messages the same way the rowid does in SQLite
+	seq int64
+	mu  sync.Mutex
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{queues: make(map[Queue]map[Consumer]*memoryConsumer)}
+}
+
+// memoryConsumer holds the messages of a single consumer, in the order they were saved.
+type memoryConsumer struct {
+	msgs  map[string]*memoryMessage
+	order []*memoryMessage
+}
+
+type memoryMessage struct {
+	Message
+	seq int64
+}
+
+func (mc *memoryConsumer) add(msg *memoryMessage) {
+	mc.msgs[msg.ID] = msg
+	mc.order = append(mc.order, msg)
+}
+
+func (mc *memoryConsumer) remove(ids map[string]bool) int {
+	removed := 0
+	order := mc.order[:0]
+	for _, msg := range mc.order {
+		if ids[msg.ID] {
+			delete(mc.msgs, msg.ID)
+			removed++
+			continue
+		}
+		order = append(order, msg)
+	}
+	mc.order = order
+	return removed
+}
+
+func (ms *MemoryStorage) InsertMany(queue Queue, msgs []Message) (map[string]bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now().UTC()
+	inserted := make(map[string]bool, len(msgs))
+	for name, consumer := range ms.getQueue(queue) {
+		for _, msg := range msgs {
+			if _, ok := consumer.msgs[msg.ID]; ok {
+				continue
+			}
+			if name == Consumer(queue) {
+				inserted[msg.ID] = true
+			}
+			ms.seq++
+			msg.CreatedAt = now
+			if !msg.DeliverAt.IsZero() {
+				msg.DeliverAt = msg.DeliverAt.UTC()
+			}
+			if !msg.ExpiresAt.IsZero() {
+				msg.ExpiresAt = msg.ExpiresAt.UTC()
+			}
+			msg.Acked, msg.VisibleAt, msg.DeliveryAttempts, msg.LastError = false, time.Time{}, 0, ""
+			consumer.add(&memoryMessage{msg, ms.seq})
+		}
+	}
+	return inserted, nil
+}
+
+func (ms *MemoryStorage) GetAll(queue Queue, consumer Consumer, limit int) ([]Message, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	pending := []*memoryMessage{}
+	for _, msg := range mc.order {
+		if !msg.Acked && !msg.VisibleAt.After(now) && !msg.DeliverAt.After(now) && !msg.expired(now) {
+			pending = append(pending, msg)
+		}
+	}
+	slices.SortStableFunc(pending, func(a, b *memoryMessage) int {
+		if a.Priority != b.Priority {
+			return b.Priority - a.Priority
+		}
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+	}
+
+	msgs := make([]Message, len(pending))
+	for i, msg := range pending {
+		msgs[i] = msg.Message
+	}
+	return msgs, nil
+}
+
+func (ms *MemoryStorage) Get(queue Queue, consumer Consumer, id string) (Message, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return Message{}, err
+	}
+	msg, ok := mc.msgs[id]
+	if !ok {
+		return Message{}, ErrMessageNotFound
+	}
+	return msg.Message, nil
+}
+
+func (ms *MemoryStorage) Ack(queue Queue, consumer Consumer, ids ...string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if msg, ok := mc.msgs[id]; ok {
+			msg.Acked, msg.VisibleAt = true, time.Time{}
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) Claim(queue Queue, consumer Consumer, id string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return false, err
+	}
+	msg, ok := mc.msgs[id]
+	if !ok || msg.Acked {
+		return false, nil
+	}
+	msg.Acked, msg.VisibleAt = true, time.Time{}
+	return true, nil
+}
+
+func (ms *MemoryStorage) AckUpTo(queue Queue, consumer Consumer, id string) ([]string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return nil, err
+	}
+	last, ok := mc.msgs[id]
+	if !ok {
+		return []string{}, nil
+	}
+
+	ids := []string{}
+	for _, msg := range mc.order {
+		if msg.seq > last.seq {
+			break
+		}
+		if !msg.Acked && msg.DeliveryAttempts > 0 {
+			msg.Acked, msg.VisibleAt = true, time.Time{}
+			ids = append(ids, msg.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (ms *MemoryStorage) Nack(queue Queue, consumer Consumer, delay time.Duration, reason string, ids ...string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return err
+	}
+	visibleAt := time.Now().UTC().Add(delay)
+	for _, id := range ids {
+		if msg, ok := mc.msgs[id]; ok && !msg.Acked {
+			msg.VisibleAt, msg.LastError = visibleAt, reason
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) Lease(queue Queue, consumer Consumer, ids []string, timeout time.Duration) (map[string]bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	leased := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		msg, ok := mc.msgs[id]
+		if !ok || msg.Acked || msg.VisibleAt.After(now) || msg.DeliverAt.After(now) || msg.expired(now) {
+			continue
+		}
+		msg.VisibleAt = now.Add(timeout)
+		msg.DeliveryAttempts++
+		leased[id] = true
+	}
+	return leased, nil
+}
+
+func (ms *MemoryStorage) GetExpired(queue Queue, consumer Consumer, limit int) ([]Message, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	msgs := []Message{}
+	for _, msg := range mc.order {
+		if limit > 0 && len(msgs) == limit {
+			break
+		}
+		if !msg.Acked && msg.expired(now) {
+			msgs = append(msgs, msg.Message)
+		}
+	}
+	return msgs, nil
+}
+
+func (ms *MemoryStorage) DeleteExpired(queue Queue, consumer Consumer) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	expired := make(map[string]bool)
+	for _, msg := range mc.order {
+		if msg.expired(now) {
+			expired[msg.ID] = true
+		}
+	}
+	return mc.remove(expired), nil
+}
+
+func (ms *MemoryStorage) GetDeadLetters(queue Queue, filter DeadLetterFilter) ([]Message, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.findConsumer(queue, Consumer(queue))
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := []Message{}
+	for _, msg := range mc.order {
+		if msg.DeadLetter == nil {
+			continue
+		}
+		if len(filter.IDs) != 0 && !slices.Contains(filter.IDs, msg.ID) {
+			continue
+		}
+		if filter.Consumer != "" && msg.DeadLetter.Consumer != filter.Consumer {
+			continue
+		}
+		if filter.Reason != "" && !strings.Contains(msg.DeadLetter.Reason, filter.Reason) {
+			continue
+		}
+		msgs = append(msgs, msg.Message)
+	}
+	slices.SortStableFunc(msgs, func(a, b Message) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	if filter.Limit > 0 && len(msgs) > filter.Limit {
+		msgs = msgs[:filter.Limit]
+	}
+	return msgs, nil
+}
+
+func (ms *MemoryStorage) Requeue(queue Queue, consumer Consumer, msg Message) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return err
+	}
+	if existing, ok := mc.msgs[msg.ID]; ok {
+		existing.Acked, existing.VisibleAt, existing.DeliveryAttempts, existing.LastError = false, time.Time{}, 0, ""
+		return nil
+	}
+
+	ms.seq++
+	mc.add(&memoryMessage{
+		Message: Message{ID: msg.ID, CreatedAt: time.Now().UTC(), Data: msg.Data, Headers: msg.Headers, Priority: msg.Priority},
+		seq:     ms.seq,
+	})
+	return nil
+}
+
+func (ms *MemoryStorage) Delete(queue Queue, ids []string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	for _, mc := range ms.getQueue(queue) {
+		mc.remove(set)
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) Subscribe(queue Queue, consumer Consumer, start StartPosition) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.getConsumer(queue, consumer, start)
+	return err
+}
+
+func (ms *MemoryStorage) Seek(queue Queue, consumer Consumer, pos StartPosition) (int, int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.findConsumer(queue, consumer)
+	if err != nil {
+		return 0, 0, err
+	}
+	if consumer != Consumer(queue) {
+		ms.backfill(queue, mc, pos)
+	}
+	before, err := mc.beforePosition(pos)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	replayed, skipped := 0, 0
+	for _, msg := range mc.order {
+		switch {
+		case msg.Acked && !before(msg):
+			msg.Acked, msg.VisibleAt, msg.DeliveryAttempts, msg.LastError = false, time.Time{}, 0, ""
+			replayed++
+		case !msg.Acked && before(msg):
+			msg.Acked, msg.VisibleAt = true, time.Time{}
+			skipped++
+		}
+	}
+	return replayed, skipped, nil
+}
+
+// backfill copies the messages since given position, that are missing in the consumer, from main, the same way
+// as DistributedSQLStorage does. They are copied as acked, so Seek replays them together with the rest.
+func (ms *MemoryStorage) backfill(queue Queue, mc *memoryConsumer, pos StartPosition) {
+	main := ms.queues[queue][Consumer(queue)]
+	before, err := main.beforePosition(pos)
+	if err != nil {
+		return
+	}
+
+	copied := false
+	for _, msg := range main.order {
+		if _, ok := mc.msgs[msg.ID]; ok || before(msg) {
+			continue
+		}
+		c := *msg
+		c.Acked, c.VisibleAt, c.DeliveryAttempts, c.LastError = true, time.Time{}, 0, ""
+		mc.add(&c)
+		copied = true
+	}
+	if copied {
+		slices.SortStableFunc(mc.order, func(a, b *memoryMessage) int { return cmp.Compare(a.seq, b.seq) })
+	}
+}
+
+func (ms *MemoryStorage) Browse(queue Queue, consumer Consumer, filter BrowseFilter) ([]Message, int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.findConsumer(queue, consumer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	msgs := []Message{}
+	var cursor int64
+	for _, msg := range mc.order {
+		if msg.seq <= filter.After {
+			continue
+		}
+		if (filter.Status == StatusPending && msg.Acked) || (filter.Status == StatusAcked && !msg.Acked) {
+			continue
+		}
+		// There is at least one more message, so the last one on the page is the cursor
+		if len(msgs) == filter.Limit {
+			return msgs, cursor, nil
+		}
+		msgs = append(msgs, msg.Message)
+		cursor = msg.seq
+	}
+	return msgs, 0, nil
+}
+
+func (ms *MemoryStorage) Stats(queue Queue, consumer Consumer) (ConsumerStats, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return ConsumerStats{}, err
+	}
+
+	now := time.Now().UTC()
+	stats := ConsumerStats{Consumer: consumer}
+	for _, msg := range mc.order {
+		switch {
+		case msg.Acked:
+			stats.Acked++
+			continue
+		case msg.DeliverAt.After(now):
+			stats.Scheduled++
+		case msg.VisibleAt.After(now):
+			stats.InFlight++
+		default:
+			stats.Pending++
+		}
+		if stats.OldestUnacked.IsZero() || msg.CreatedAt.Before(stats.OldestUnacked) {
+			stats.OldestUnacked = msg.CreatedAt
+		}
+	}
+	return stats, nil
+}
+
+func (ms *MemoryStorage) Queues() ([]Queue, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	queues := make([]Queue, 0, len(ms.queues))
+	for queue := range ms.queues {
+		queues = append(queues, queue)
+	}
+	slices.Sort(queues)
+	return queues, nil
+}
+
+func (ms *MemoryStorage) Consumers(queue Queue) ([]Consumer, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	consumers, ok := ms.queues[queue]
+	if !ok {
+		return nil, ErrQueueNotFound
+	}
+	names := make([]Consumer, 0, len(consumers))
+	for consumer := range consumers {
+		names = append(names, consumer)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (ms *MemoryStorage) Purge(queue Queue) (map[Consumer]int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	consumers, ok := ms.queues[queue]
+	if !ok {
+		return nil, ErrQueueNotFound
+	}
+	removed := make(map[Consumer]int, len(consumers))
+	for consumer, mc := range consumers {
+		removed[consumer] = len(mc.order)
+		consumers[consumer] = &memoryConsumer{msgs: make(map[string]*memoryMessage)}
+	}
+	return removed, nil
+}
+
+func (ms *MemoryStorage) DeleteConsumer(queue Queue, consumer Consumer) error {
+	if consumer == Consumer(queue) {
+		return ErrMainConsumer
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.findConsumer(queue, consumer)
+	if err != nil {
+		return err
+	}
+	delete(ms.queues[queue], consumer)
+	return nil
+}
+
+func (ms *MemoryStorage) DeleteQueue(queue Queue) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.queues[queue]; !ok {
+		return ErrQueueNotFound
+	}
+	delete(ms.queues, queue)
+	return nil
+}
+
+func (ms *MemoryStorage) Trim(queue Queue, consumer Consumer, retention Retention) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	mc, err := ms.getConsumer(queue, consumer, StartPosition{})
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	removed := make(map[string]bool)
+	count := 0
+	var size int64
+	// Go from the newest, so the limits keep the newest messages
+	for i := len(mc.order) - 1; i >= 0; i-- {
+		msg := mc.order[i]
+		age := now.Sub(msg.CreatedAt)
+		count++
+		size += int64(len(msg.Data))
+		if len(msg.Headers) != 0 {
+			b, _ := json.Marshal(msg.Headers)
+			size += int64(len(b))
+		}
+		switch {
+		case msg.Acked && retention.AckedMaxAge > 0 && age > retention.AckedMaxAge,
+			!msg.Acked && retention.UnackedMaxAge > 0 && age > retention.UnackedMaxAge,
+			retention.MaxMessages > 0 && count > retention.MaxMessages,
+			retention.MaxBytes > 0 && size > retention.MaxBytes:
+			removed[msg.ID] = true
+		}
+	}
+
+	return mc.remove(removed), nil
+}
+
+// Vacuum does nothing, because the memory of removed messages is given back by the garbage collector.
+func (ms *MemoryStorage) Vacuum(queue Queue) error {
+	return nil
+}
+
+// CloseIdle does nothing, because the memory storage has nothing to release.
+func (ms *MemoryStorage) CloseIdle() (int, error) {
+	return 0, nil
+}
+
+// getQueue returns the consumers of given queue, creating the queue with the main consumer if it doesn't exist.
+func (ms *MemoryStorage) getQueue(queue Queue) map[Consumer]*memoryConsumer {
+	consumers, ok := ms.queues[queue]
+	if !ok {
+		consumers = map[Consumer]*memoryConsumer{
+			Consumer(queue): {msgs: make(map[string]*memoryMessage)},
+		}
+		ms.queues[queue] = consumers
+	}
+	return consumers
+}
+
+// getConsumer returns given consumer, and if it is new, copies the messages from main, starting from given position.
+func (ms *MemoryStorage) getConsumer(queue Queue, consumer Consumer, start StartPosition) (*memoryConsumer, error) {
+	// Default consumer to queue name (main)
+	if consumer == "" {
+		consumer = Consumer(queue)
+	}
+
+	consumers := ms.getQueue(queue)
+	if mc, ok := consumers[consumer]; ok {
+		return mc, nil
+	}
+
+	// Copy the messages from main, but only since the start position
+	main := consumers[Consumer(queue)]
+	before, err := main.beforePosition(start)
+	if err != nil {
+		return nil, err
+	}
+	mc := &memoryConsumer{msgs: make(map[string]*memoryMessage, len(main.msgs))}
+	for _, msg := range main.order {
+		if before(msg) {
+			continue
+		}
+		copied := *msg
+		copied.Acked, copied.VisibleAt, copied.DeliveryAttempts, copied.LastError = false, time.Time{}, 0, ""
+		mc.add(&copied)
+	}
+
+	consumers[consumer] = mc
+	return mc, nil
+}
+
+// findConsumer returns given consumer, without creating it.
+func (ms *MemoryStorage) findConsumer(queue Queue, consumer Consumer) (*memoryConsumer, error) {
+	consumers, ok := ms.queues[queue]
+	if !ok {
+		return nil, ErrQueueNotFound
+	}
+	mc, ok := consumers[consumer]
+	if !ok {
+		return nil, ErrConsumerNotFound
+	}
+	return mc, nil
+}
+
+// beforePosition returns the function, that matches the messages published before the position.
+func (mc *memoryConsumer) beforePosition(pos StartPosition) (func(*memoryMessage) bool, error) {
+	switch pos.Kind {
+	case StartLatest:
+		return func(*memoryMessage) bool { return true }, nil
+	case StartTimestamp:
+		return func(msg *memoryMessage) bool { return msg.CreatedAt.Before(pos.Time) }, nil
+	case StartMessage:
+		start, ok := mc.msgs[pos.ID]
+		if !ok {
+			return nil, ErrMessageNotFound
+		}
+		return func(msg *memoryMessage) bool { return msg.seq < start.seq }, nil
+	}
+	return func(*memoryMessage) bool { return false }, nil
+}
+
+// NewStorage creates the storages used by the queues in the config. If the queues use different storages,
+// the returned storage routes every queue to the one configured for it.
+func NewStorage(config *Config) (Storage, error) {
+	kinds := []StorageKind{config.Options("", "").Storage}
+	for queue := range config.Queues {
+		kind := config.Options(queue, "").Storage
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	storages := make(map[StorageKind]Storage, len(kinds))
+	for _, kind := range kinds {
+		switch kind {
+		case StorageSQLite:
+			storages[kind] = NewDistributedSQLStorage(NewConnectionMap())
+		case StorageSQLiteLog:
+			storages[kind] = NewLogSQLStorage(NewConnectionMap())
+		case StorageMemory:
+			storages[kind] = NewMemoryStorage()
+		default:
+			return nil, fmt.Errorf("unknown storage: %s", kind)
+		}
+	}
+
+	if len(storages) == 1 {
+		return storages[kinds[0]], nil
+	}
+	return &RoutedStorage{storages, config}, nil
+}
+
+// RoutedStorage passes the operations on every queue to the storage configured for it.
+type RoutedStorage struct {
+	storages map[StorageKind]Storage
+	config   *Config
+}
+
+var _ Storage = (*RoutedStorage)(nil)
+
+func (rs *RoutedStorage) InsertMany(queue Queue, msgs []Message) (map[string]bool, error) {
+	return rs.route(queue).InsertMany(queue, msgs)
+}
+
+func (rs *RoutedStorage) GetAll(queue Queue, consumer Consumer, limit int) ([]Message, error) {
+	return rs.route(queue).GetAll(queue, consumer, limit)
+}
+
+func (rs *RoutedStorage) Get(queue Queue, consumer Consumer, id string) (Message, error) {
+	return rs.route(queue).Get(queue, consumer, id)
+}
+
+func (rs *RoutedStorage) Ack(queue Queue, consumer Consumer, ids ...string) error {
+	return rs.route(queue).Ack(queue, consumer, ids...)
+}
+
+func (rs *RoutedStorage) Claim(queue Queue, consumer Consumer, id string) (bool, error) {
+	return rs.route(queue).Claim(queue, consumer, id)
+}
+
+func (rs *RoutedStorage) AckUpTo(queue Queue, consumer Consumer, id string) ([]string, error) {
+	return rs.route(queue).AckUpTo(queue, consumer, id)
+}
+
+func (rs *RoutedStorage) Nack(queue Queue, consumer Consumer, delay time.Duration, reason string, ids ...string) error {
+	return rs.route(queue).Nack(queue, consumer, delay, reason, ids...)
+}
+
+func (rs *RoutedStorage) Lease(queue Queue, consumer Consumer, ids []string, timeout time.Duration) (map[string]bool, error) {
+	return rs.route(queue).Lease(queue, consumer, ids, timeout)
+}
+
+func (rs *RoutedStorage) Requeue(queue Queue, consumer Consumer, msg Message) error {
+	return rs.route(queue).Requeue(queue, consumer, msg)
+}
+
+func (rs *RoutedStorage) Delete(queue Queue, ids []string) error {
+	return rs.route(queue).Delete(queue, ids)
+}
+
+func (rs *RoutedStorage) GetDeadLetters(queue Queue, filter DeadLetterFilter) ([]Message, error) {
+	return rs.route(queue).GetDeadLetters(queue, filter)
+}
+
+func (rs *RoutedStorage) Subscribe(queue Queue, consumer Consumer, start StartPosition) error {
+	return rs.route(queue).Subscribe(queue, consumer, start)
+}
+
+func (rs *RoutedStorage) Seek(queue Queue, consumer Consumer, pos StartPosition) (int, int, error) {
+	return rs.route(queue).Seek(queue, consumer, pos)
+}
+
+func (rs *RoutedStorage) Browse(queue Queue, consumer Consumer, filter BrowseFilter) ([]Message, int64, error) {
+	return rs.route(queue).Browse(queue, consumer, filter)
+}
+
+func (rs *RoutedStorage) Stats(queue Queue, consumer Consumer) (ConsumerStats, error) {
+	return rs.route(queue).Stats(queue, consumer)
+}
+
+// Queues returns the names of the queues from all the storages.
+func (rs *RoutedStorage) Queues() ([]Queue, error) {
+	queues := []Queue{}
+	for _, storage := range rs.storages {
+		qs, err := storage.Queues()
+		if err != nil {
+			return nil, err
+		}
+		for _, queue := range qs {
+			// Skip the queues that were left in a storage, after the config changed
+			if rs.route(queue) == storage {
+				queues = append(queues, queue)
+			}
+		}
+	}
+	slices.Sort(queues)
+	return queues, nil
+}
+
+func (rs *RoutedStorage) Consumers(queue Queue) ([]Consumer, error) {
+	return rs.route(queue).Consumers(queue)
+}
+
+func (rs *RoutedStorage) Purge(queue Queue) (map[Consumer]int, error) {
+	return rs.route(queue).Purge(queue)
+}
+
+func (rs *RoutedStorage) DeleteConsumer(queue Queue, consumer Consumer) error {
+	return rs.route(queue).DeleteConsumer(queue, consumer)
+}
+
+func (rs *RoutedStorage) DeleteQueue(queue Queue) error {
+	return rs.route(queue).DeleteQueue(queue)
+}
+
+func (rs *RoutedStorage) GetExpired(queue Queue, consumer Consumer, limit int) ([]Message, error) {
+	return rs.route(queue).GetExpired(queue, consumer, limit)
+}
+
+func (rs *RoutedStorage) DeleteExpired(queue Queue, consumer Consumer) (int, error) {
+	return rs.route(queue).DeleteExpired(queue, consumer)
+}
+
+func (rs *RoutedStorage) Trim(queue Queue, consumer Consumer, retention Retention) (int, error) {
+	return rs.route(queue).Trim(queue, consumer, retention)
+}
+
+func (rs *RoutedStorage) Vacuum(queue Queue) error {
+	return rs.route(queue).Vacuum(queue)
+}
+
+func (rs *RoutedStorage) CloseIdle() (int, error) {
+	closed := 0
+	errs := []error{}
+	for _, storage := range rs.storages {
+		n, err := storage.CloseIdle()
+		closed += n
+		errs = append(errs, err)
+	}
+	return closed, errors.Join(errs...)
+}
+
+// route returns the storage configured for given queue.
+func (rs *RoutedStorage) route(queue Queue) Storage {
+	return rs.storages[rs.config.Options(queue, "").Storage]
+}
+
+// logMessagesQuery selects the messages of the queue, together with their delivery state for the consumer
+// passed as the first argument. Messages before the start of the consumer, that were never delivered to it, are acked.
+const logMessagesQuery = `
+WITH consumer_messages AS (
+	SELECT
+		m.seq, m.id, m.created_at, m.data, m.headers, m.priority, m.deliver_at, m.expires_at,
+		COALESCE(d.acked, m.seq < c.start_seq) AS acked,
+		d.visible_at,
+		COALESCE(d.delivery_attempts, 0) AS delivery_attempts,
+		COALESCE(d.last_error, '') AS last_error
+	FROM messages m
+	JOIN consumers c ON c.name = ?
+	LEFT JOIN deliveries d ON d.consumer = c.name AND d.seq = m.seq
+)
+SELECT seq, id, created_at, data, headers, priority, deliver_at, expires_at, acked, visible_at, delivery_attempts, last_error
+FROM consumer_messages`
+
+// logPendingFilter limits the messages to the ones that can be unacked for the consumer: the ones since its start,
+// and the ones before it, that were made pending again. Both are found through the indexes, so the acked history
+// before the start is not scanned. Arguments are the consumer, and the consumer again.
+const logPendingFilter = `seq IN (
+	SELECT seq FROM messages WHERE seq >= (SELECT start_seq FROM consumers WHERE name = ?)
+	UNION ALL
+	SELECT seq FROM deliveries WHERE consumer = ? AND acked = 0
+)`
+
+// advanceStartQuery moves the start of the consumer past the messages it acked, up to the first one that is not acked,
+// so that the pending messages are found without going through the acked history.
+// Messages before the start are acked only if they have no delivery state, so the start never passes a message
+// without it. Argument is the consumer.
+const advanceStartQuery = `
+UPDATE consumers SET start_seq = MAX(start_seq, COALESCE(
+	(
+		SELECT m.seq FROM messages m
+		LEFT JOIN deliveries d ON d.consumer = consumers.name AND d.seq = m.seq
+		WHERE m.seq >= consumers.start_seq AND COALESCE(d.acked, 0) = 0
+		ORDER BY m.seq ASC
+		LIMIT 1
+	),
+	(SELECT COALESCE(MAX(seq), 0) + 1 FROM messages)
+))
+WHERE name = ?;`
+
+// ensureDeliveryQuery creates the delivery state of the message for the consumer, unless it is acked by the start position.
+// Arguments are the consumer, the consumer again, and the message id.
+const ensureDeliveryQuery = `
+INSERT INTO deliveries (consumer, seq, id)
+SELECT ?, seq, id FROM messages WHERE seq >= (SELECT start_seq FROM consumers WHERE name = ?) AND id = ?
+ON CONFLICT (consumer, seq) DO NOTHING;`
+
+// LogSQLStorage keeps a single SQLite database for every queue, with one log of messages shared by all the consumers.
+// Consumers store only the position they started from, and the state of the messages that were delivered to them.
+type LogSQLStorage struct {
+	connMap *ConnectionMap
+	// consumers caches the consumers that are known to exist in the database
+	consumers map[Queue]map[Consumer]bool
+	mu        sync.Mutex
+}
+
+var _ Storage = (*LogSQLStorage)(nil)
+
+func NewLogSQLStorage(connMap *ConnectionMap) *LogSQLStorage {
+	return &LogSQLStorage{connMap: connMap, consumers: make(map[Queue]map[Consumer]bool)}
+}
+
+// InsertMany appends the messages to the log of the queue, in one transaction.
+// Messages that already exist in the log are skipped, so the insert can be safely retried.
+func (ls *LogSQLStorage) InsertMany(queue Queue, msgs []Message) (map[string]bool, error) {
+	conn, err := ls.getConn(queue)
+	if err != nil {
+		return nil, err
+	}
+	return insertMessages(conn.DB, msgs)
+}
+
+func (ls *LogSQLStorage) GetAll(queue Queue, consumer Consumer, limit int) ([]Message, error) {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Negative limit means no limit in SQLite
+	if limit <= 0 {
+		limit = -1
+	}
+
+	now := time.Now().UTC()
+	msgs, _, err := queryLogMessages(conn.DB, `
+WHERE `+logPendingFilter+` AND acked = 0
+AND (visible_at IS NULL OR visible_at <= ?) AND (deliver_at IS NULL OR deliver_at <= ?) AND (expires_at IS NULL OR expires_at > ?)
+ORDER BY priority DESC, created_at ASC, seq ASC
+LIMIT ?;`,
+		consumer, consumer, consumer, now, now, now, limit,
+	)
+	return msgs, err
+}
+
+func (ls *LogSQLStorage) Get(queue Queue, consumer Consumer, id string) (Message, error) {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return Message{}, err
+	}
+
+	msgs, _, err := queryLogMessages(conn.DB, " WHERE id = ?;", consumer, id)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(msgs) == 0 {
+		return Message{}, ErrMessageNotFound
+	}
+	return msgs[0], nil
+}
+
+func (ls *LogSQLStorage) Ack(queue Queue, consumer Consumer, ids ...string) error {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return err
+	}
+
+	err = execDeliveries(conn.DB, consumer, "UPDATE deliveries SET acked = 1, visible_at = NULL WHERE consumer = ? AND id = ?;", ids)
+	if err != nil {
+		return fmt.Errorf("updating messages: %w", err)
+	}
+
+	_, err = conn.DB.Exec(advanceStartQuery, consumer)
+	if err != nil {
+		return fmt.Errorf("updating consumer: %w", err)
+	}
+	return nil
+}
+
+func (ls *LogSQLStorage) Claim(queue Queue, consumer Consumer, id string) (bool, error) {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Messages before the start of the consumer are acked already, so they get no delivery state
+	_, err = tx.Exec(ensureDeliveryQuery, consumer, consumer, id)
+	if err != nil {
+		return false, fmt.Errorf("inserting delivery: %w", err)
+	}
+	res, err := tx.Exec("UPDATE deliveries SET acked = 1, visible_at = NULL WHERE consumer = ? AND id = ? AND acked = 0;", consumer, id)
+	if err != nil {
+		return false, fmt.Errorf("updating message: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("reading affected rows: %w", err)
+	}
+	_, err = tx.Exec(advanceStartQuery, consumer)
+	if err != nil {
+		return false, fmt.Errorf("updating consumer: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, fmt.Errorf("committing transaction: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (ls *LogSQLStorage) AckUpTo(queue Queue, consumer Consumer, id string) ([]string, error) {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Delivered messages always have the delivery state, so there is no need to look at the log
+	rows, err := conn.DB.Query(`
+UPDATE deliveries SET acked = 1, visible_at = NULL
+WHERE consumer = ? AND acked = 0 AND delivery_attempts > 0 AND seq <= (SELECT seq FROM messages WHERE id = ?)
+RETURNING id;`,
+		consumer, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("updating messages: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+	// Release the connection, that still holds the write lock
+	rows.Close()
+
+	_, err = conn.DB.Exec(advanceStartQuery, consumer)
+	if err != nil {
+		return nil, fmt.Errorf("updating consumer: %w", err)
+	}
+
+	return ids, nil
+}
+
+func (ls *LogSQLStorage) Nack(queue Queue, consumer Consumer, delay time.Duration, reason string, ids ...string) error {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return err
+	}
+
+	err = execDeliveries(
+		conn.DB,
+		consumer,
+		"UPDATE deliveries SET visible_at = ?, last_error = ? WHERE acked = 0 AND consumer = ? AND id = ?;",
+		ids,
+		time.Now().UTC().Add(delay), reason,
+	)
+	if err != nil {
+		return fmt.Errorf("updating messages: %w", err)
+	}
+	return nil
+}
+
+func (ls *LogSQLStorage) Lease(queue Queue, consumer Consumer, ids []string, timeout time.Duration) (map[string]bool, error) {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ensure, err := tx.Prepare(ensureDeliveryQuery)
+	if err != nil {
+		return nil, fmt.Errorf("preparing statement: %w", err)
+	}
+	defer ensure.Close()
+
+	stmt, err := tx.Prepare(`
+UPDATE deliveries SET visible_at = ?, delivery_attempts = delivery_attempts + 1
+WHERE consumer = ? AND id = ? AND acked = 0 AND (visible_at IS NULL OR visible_at <= ?)
+AND NOT EXISTS (SELECT 1 FROM messages WHERE messages.seq = deliveries.seq AND (deliver_at > ? OR expires_at <= ?));`)
+	if err != nil {
+		return nil, fmt.Errorf("preparing statement: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	leased := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		_, err = ensure.Exec(consumer, consumer, id)
+		if err != nil {
+			return nil, fmt.Errorf("inserting delivery: %w", err)
+		}
+		res, err := stmt.Exec(now.Add(timeout), consumer, id, now, now, now)
+		if err != nil {
+			return nil, fmt.Errorf("updating message: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("reading affected rows: %w", err)
+		}
+		if n == 1 {
+			leased[id] = true
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return leased, nil
+}
+
+func (ls *LogSQLStorage) GetExpired(queue Queue, consumer Consumer, limit int) ([]Message, error) {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Negative limit means no limit in SQLite
+	if limit <= 0 {
+		limit = -1
+	}
+
+	msgs, _, err := queryLogMessages(
+		conn.DB,
+		" WHERE "+logPendingFilter+" AND acked = 0 AND expires_at <= ? ORDER BY seq ASC LIMIT ?;",
+		consumer, consumer, consumer, time.Now().UTC(), limit,
+	)
+	return msgs, err
+}
+
+// DeleteExpired removes the expired messages from the log. Expiry is the same for all the consumers,
+// so the messages are removed only together with the main consumer.
+func (ls *LogSQLStorage) DeleteExpired(queue Queue, consumer Consumer) (int, error) {
+	if consumer != Consumer(queue) {
+		return 0, nil
+	}
+
+	conn, err := ls.getConn(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM messages WHERE expires_at <= ?;", time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("deleting messages: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("reading affected rows: %w", err)
+	}
+	_, err = tx.Exec("DELETE FROM deliveries WHERE seq NOT IN (SELECT seq FROM messages);")
+	if err != nil {
+		return 0, fmt.Errorf("deleting deliveries: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return int(n), nil
+}
+
+// Requeue makes the message pending again for the consumer, as if it was never delivered.
+// If the message is missing in the log, it is appended, but only for given consumer.
+func (ls *LogSQLStorage) Requeue(queue Queue, consumer Consumer, msg Message) error {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+INSERT INTO messages (id, data, headers, priority) VALUES (?, ?, ?, ?)
+ON CONFLICT (id) DO NOTHING;`,
+		msg.ID, msg.Data, msg.Headers, msg.Priority,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting message: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("reading affected rows: %w", err)
+	}
+	// Other consumers would get the appended message as a new one
+	if n == 1 {
+		_, err = tx.Exec(`
+INSERT INTO deliveries (consumer, seq, id, acked)
+SELECT c.name, m.seq, m.id, 1 FROM consumers c, messages m WHERE m.id = ? AND c.name != ?;`,
+			msg.ID, consumer,
+		)
+		if err != nil {
+			return fmt.Errorf("inserting deliveries: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO deliveries (consumer, seq, id)
+SELECT ?, seq, id FROM messages WHERE id = ?
+ON CONFLICT (consumer, seq) DO UPDATE SET acked = 0, visible_at = NULL, delivery_attempts = 0, last_error = NULL;`,
+		consumer, msg.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("upserting delivery: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the messages with given ids from the log, together with their delivery state.
+func (ls *LogSQLStorage) Delete(queue Queue, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	conn, err := ls.getConn(queue)
+	if err != nil {
+		return err
+	}
+
+	in := fmt.Sprintf("id IN (?%s)", strings.Repeat(", ?", len(ids)-1))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"messages", "deliveries"} {
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s;", table, in), args...)
+		if err != nil {
+			return fmt.Errorf("deleting messages: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDeadLetters retrieves the dead-lettered messages from the log of given (dead-letter) queue, that match the filter.
+// The queue is not created, if it doesn't exist.
+func (ls *LogSQLStorage) GetDeadLetters(queue Queue, filter DeadLetterFilter) ([]Message, error) {
+	conn, err := ls.findConn(queue)
+	if err != nil {
+		return nil, err
+	}
+	return queryDeadLetters(conn.DB, filter)
+}
+
+func (ls *LogSQLStorage) Subscribe(queue Queue, consumer Consumer, start StartPosition) error {
+	_, _, err := ls.getConsumerConn(queue, consumer, start)
+	return err
+}
+
+// Seek moves the start position of the consumer, in one transaction. Messages before the position are acked,
+// and the acked messages since the position are made pending again, as if they were never delivered.
+func (ls *LogSQLStorage) Seek(queue Queue, consumer Consumer, pos StartPosition) (int, int, error) {
+	conn, err := ls.findConsumerConn(queue, consumer)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	start, err := startSeq(tx, pos)
+	if err != nil {
+		return 0, 0, err
+	}
+	var prev int64
+	err = tx.QueryRow("SELECT start_seq FROM consumers WHERE name = ?;", consumer).Scan(&prev)
+	if err != nil {
+		return 0, 0, fmt.Errorf("scanning row: %w", err)
+	}
+
+	// Messages between the positions, that were never delivered, change their state together with the position
+	var between int
+	err = tx.QueryRow(`
+SELECT COUNT(*) FROM messages m
+WHERE seq >= ? AND seq < ? AND NOT EXISTS (SELECT 1 FROM deliveries d WHERE d.consumer = ? AND d.seq = m.seq);`,
+		min(start, prev), max(start, prev), consumer,
+	).Scan(&between)
+	if err != nil {
+		return 0, 0, fmt.Errorf("scanning row: %w", err)
+	}
+
+	res, err := tx.Exec(`
+UPDATE deliveries SET acked = 0, visible_at = NULL, delivery_attempts = 0, last_error = NULL
+WHERE consumer = ? AND acked = 1 AND seq >= ?;`,
+		consumer, start,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("updating messages: %w", err)
+	}
+	replayed, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading affected rows: %w", err)
+	}
+
+	res, err = tx.Exec("UPDATE deliveries SET acked = 1, visible_at = NULL WHERE consumer = ? AND acked = 0 AND seq < ?;", consumer, start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("updating messages: %w", err)
+	}
+	skipped, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading affected rows: %w", err)
+	}
+
+	// first_seq tells which part of the log the consumer has seen, so it only moves back
+	_, err = tx.Exec("UPDATE consumers SET start_seq = ?1, first_seq = MIN(first_seq, ?1) WHERE name = ?2;", start, consumer)
+	if err != nil {
+		return 0, 0, fmt.Errorf("updating consumer: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	if start < prev {
+		replayed += int64(between)
+	} else {
+		skipped += int64(between)
+	}
+	return int(replayed), int(skipped), nil
+}
+
+func (ls *LogSQLStorage) Browse(queue Queue, consumer Consumer, filter BrowseFilter) ([]Message, int64, error) {
+	conn, err := ls.findConsumerConn(queue, consumer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := " WHERE seq > ?"
+	switch filter.Status {
+	case StatusPending:
+		query += " AND acked = 0"
+	case StatusAcked:
+		query += " AND acked = 1"
+	}
+	// Fetch one more message, to know if there is a next page
+	query += " ORDER BY seq ASC LIMIT ?;"
+
+	msgs, seqs, err := queryLogMessages(conn.DB, query, consumer, filter.After, filter.Limit+1)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(msgs) <= filter.Limit {
+		return msgs, 0, nil
+	}
+	return msgs[:filter.Limit], seqs[filter.Limit-1], nil
+}
+
+func (ls *LogSQLStorage) Stats(queue Queue, consumer Consumer) (ConsumerStats, error) {
+	conn, consumer, err := ls.getConsumerConn(queue, consumer, StartPosition{})
+	if err != nil {
+		return ConsumerStats{}, err
+	}
+
+	stats := ConsumerStats{Consumer: consumer}
+	var oldest sql.NullString
+	now := time.Now().UTC()
+	err = conn.DB.QueryRow(`
+WITH consumer_messages AS (
+	SELECT m.created_at, m.deliver_at, COALESCE(d.acked, m.seq < c.start_seq) AS acked, d.visible_at
+	FROM messages m
+	JOIN consumers c ON c.name = ?
+	LEFT JOIN deliveries d ON d.consumer = c.name AND d.seq = m.seq
+)
+SELECT
+	COALESCE(SUM(acked = 0 AND deliver_at > ?), 0),
+	COALESCE(SUM(acked = 0 AND visible_at > ?), 0),
+	COALESCE(SUM(acked = 1), 0),
+	COALESCE(SUM(acked = 0), 0),
+	MIN(CASE WHEN acked = 0 THEN created_at END)
+FROM consumer_messages;`,
+		consumer, now, now,
+	).Scan(&stats.Scheduled, &stats.InFlight, &stats.Acked, &stats.Pending, &oldest)
+	if err != nil {
+		return ConsumerStats{}, fmt.Errorf("scanning row: %w", err)
+	}
+	stats.Pending -= stats.Scheduled + stats.InFlight
+
+	if oldest.Valid {
+		stats.OldestUnacked, err = time.Parse(time.DateTime, oldest.String)
+		if err != nil {
+			return ConsumerStats{}, fmt.Errorf("parsing created at: %w", err)
+		}
+	}
+
+	return stats, nil
+}
+
+func (ls *LogSQLStorage) Queues() ([]Queue, error) {
+	names, err := sqlite.GetLogDBNames()
+	if err != nil {
+		return nil, fmt.Errorf("reading names: %w", err)
+	}
+
+	queues := make([]Queue, len(names))
+	for i, name := range names {
+		queues[i] = Queue(name)
+	}
+	return queues, nil
+}
+
+func (ls *LogSQLStorage) Consumers(queue Queue) ([]Consumer, error) {
+	conn, err := ls.findConn(queue)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.DB.Query("SELECT name FROM consumers ORDER BY name;")
+	if err != nil {
+		return nil, fmt.Errorf("querying consumers: %w", err)
+	}
+	defer rows.Close()
+
+	consumers := []Consumer{}
+	for rows.Next() {
+		var consumer Consumer
+		err = rows.Scan(&consumer)
+		if err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		consumers = append(consumers, consumer)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return consumers, nil
+}
+
+// Purge removes all the messages from the log, and returns how many were removed for each consumer.
+func (ls *LogSQLStorage) Purge(queue Queue) (map[Consumer]int, error) {
+	consumers, err := ls.Consumers(queue)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ls.getConn(queue)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Every consumer counts only the messages since the earliest position it had, the same way as DistributedSQLStorage
+	rows, err := tx.Query("SELECT c.name, (SELECT COUNT(*) FROM messages WHERE seq >= c.first_seq) FROM consumers c;")
+	if err != nil {
+		return nil, fmt.Errorf("counting messages: %w", err)
+	}
+	defer rows.Close()
+	removed := make(map[Consumer]int, len(consumers))
+	for rows.Next() {
+		var consumer Consumer
+		var n int
+		err = rows.Scan(&consumer, &n)
+		if err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+		removed[consumer] = n
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+	rows.Close()
+
+	_, err = tx.Exec("DELETE FROM messages;")
+	if err != nil {
+		return nil, fmt.Errorf("deleting messages: %w", err)
+	}
+	_, err = tx.Exec("DELETE FROM deliveries;")
+	if err != nil {
+		return nil, fmt.Errorf("deleting deliveries: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return removed, nil
+}
+
+// DeleteConsumer removes the consumer, together with the delivery state of its messages.
+// Main consumer can't be deleted, so the behavior is the same as with DistributedSQLStorage.
+func (ls *LogSQLStorage) DeleteConsumer(queue Queue, consumer Consumer) error {
+	if consumer == Consumer(queue) {
+		return ErrMainConsumer
+	}
+
+	conn, err := ls.findConsumerConn(queue, consumer)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM deliveries WHERE consumer = ?;", consumer)
+	if err != nil {
+		return fmt.Errorf("deleting deliveries: %w", err)
+	}
+	_, err = tx.Exec("DELETE FROM consumers WHERE name = ?;", consumer)
+	if err != nil {
+		return fmt.Errorf("deleting consumer: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	ls.mu.Lock()
+	delete(ls.consumers[queue], consumer)
+	ls.mu.Unlock()
+
+	return nil
+}
+
+// DeleteQueue closes the connection, and removes the database of the queue.
+func (ls *LogSQLStorage) DeleteQueue(queue Queue) error {
+	_, err := ls.findConn(queue)
+	if err != nil {
+		return err
+	}
+
+	err = ls.connMap.DeleteQueue(queue)
+	if err != nil {
+		return fmt.Errorf("closing connection: %w", err)
+	}
+
+	err = sqlite.RemoveDB("", string(queue))
+	if err != nil {
+		return fmt.Errorf("removing db: %w", err)
+	}
+
+	ls.mu.Lock()
+	delete(ls.consumers, queue)
+	ls.mu.Unlock()
+
+	return nil
+}
+
+// Trim removes the messages outside of the retention from the log. The log is shared by all the consumers,
+// so only the retention of the main consumer is applied, and a message is acked when all the consumers acked it.
+// The main consumer is always registered, but it counts only if it reads the queue, or there are no other consumers,
+// otherwise acked messages would never be removed.
+func (ls *LogSQLStorage) Trim(queue Queue, consumer Consumer, retention Retention) (int, error) {
+	if consumer != Consumer(queue) {
+		return 0, nil
+	}
+
+	conn, err := ls.getConn(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	unacked := `EXISTS (
+	SELECT 1 FROM consumers c LEFT JOIN deliveries d ON d.consumer = c.name AND d.seq = messages.seq
+	WHERE COALESCE(d.acked, messages.seq < c.start_seq) = 0
+	AND (
+		c.name != ?1
+		OR EXISTS (SELECT 1 FROM deliveries WHERE consumer = c.name)
+		OR NOT EXISTS (SELECT 1 FROM consumers WHERE name != ?1)
+	)
+)`
+	return trimMessages(conn.DB, retention, trimLayout{
+		acked:   "NOT " + unacked,
+		unacked: unacked,
+		args:    []any{queue},
+		seq:     "seq",
+		cleanup: "DELETE FROM deliveries WHERE seq NOT IN (SELECT seq FROM messages);",
+	})
+}
+
+// Vacuum gives back the space of the removed messages.
+func (ls *LogSQLStorage) Vacuum(queue Queue) error {
+	conn, err := ls.getConn(queue)
+	if err != nil {
+		return err
+	}
+	return sqlite.Vacuum(conn.DB)
+}
+
+// CloseIdle removes the connections that were not used for a while.
+func (ls *LogSQLStorage) CloseIdle() (int, error) {
+	return ls.connMap.Clean()
+}
+
+// getConn gets the connection to the database of the queue, creating the database with the main consumer if needed.
+func (ls *LogSQLStorage) getConn(queue Queue) (*Connection, error) {
+	conn := ls.connMap.Get(queue, Consumer(queue))
+	if conn != nil {
+		return conn, nil
+	}
+
+	db, err := sqlite.GetLogDB(string(queue))
+	if err != nil {
+		return nil, fmt.Errorf("getting db: %w", err)
+	}
+	_, err = db.Exec("INSERT INTO consumers (name) VALUES (?) ON CONFLICT (name) DO NOTHING;", queue)
+	if err != nil {
+		return nil, fmt.Errorf("inserting main consumer: %w", err)
+	}
+
+	conn = &Connection{db, time.Now().Add(defaultTTL)}
+	ls.connMap.Set(queue, Consumer(queue), conn)
+	return conn, nil
+}
+
+// findConn gets the connection to the database of the queue, without creating it.
+func (ls *LogSQLStorage) findConn(queue Queue) (*Connection, error) {
+	queues, err := ls.Queues()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(queues, queue) {
+		return nil, ErrQueueNotFound
+	}
+	return ls.getConn(queue)
+}
+
+// getConsumerConn gets the connection to the database of the queue, and if the consumer is new,
+// creates it starting from given position. It returns the consumer, defaulted to the main one.
+func (ls *LogSQLStorage) getConsumerConn(queue Queue, consumer Consumer, start StartPosition) (*Connection, Consumer, error) {
+	// Default consumer to queue name (main)
+	if consumer == "" {
+		consumer = Consumer(queue)
+	}
+
+	conn, err := ls.getConn(queue)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.consumers[queue][consumer] {
+		return conn, consumer, nil
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM consumers WHERE name = ?);", consumer).Scan(&exists)
+	if err != nil {
+		return nil, "", fmt.Errorf("scanning row: %w", err)
+	}
+	if !exists {
+		seq, err := startSeq(tx, start)
+		if err != nil {
+			return nil, "", err
+		}
+		_, err = tx.Exec("INSERT INTO consumers (name, start_seq, first_seq) VALUES (?, ?, ?);", consumer, seq, seq)
+		if err != nil {
+			return nil, "", fmt.Errorf("inserting consumer: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, "", fmt.Errorf("committing transaction: %w", err)
+	}
+
+	if ls.consumers[queue] == nil {
+		ls.consumers[queue] = make(map[Consumer]bool)
+	}
+	ls.consumers[queue][consumer] = true
+	return conn, consumer, nil
+}
+
+// findConsumerConn gets the connection to the database of the queue, making sure that the consumer exists.
+func (ls *LogSQLStorage) findConsumerConn(queue Queue, consumer Consumer) (*Connection, error) {
+	consumers, err := ls.Consumers(queue)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(consumers, consumer) {
+		return nil, ErrConsumerNotFound
+	}
+	return ls.getConn(queue)
+}
+
+// startSeq returns the sequence number of the first message, that is delivered to the consumer starting from given position.
+func startSeq(tx *sql.Tx, pos StartPosition) (int64, error) {
+	var seq int64
+	var err error
+	switch pos.Kind {
+	case StartEarliest:
+		return 0, nil
+	case StartLatest:
+		err = tx.QueryRow("SELECT COALESCE(MAX(seq), 0) + 1 FROM messages;").Scan(&seq)
+	case StartTimestamp:
+		// created_at is stored with second precision, in the same format as time.DateTime
+		err = tx.QueryRow(
+			"SELECT COALESCE(MIN(seq), (SELECT COALESCE(MAX(seq), 0) + 1 FROM messages)) FROM messages WHERE created_at >= ?;",
+			pos.Time.UTC().Format(time.DateTime),
+		).Scan(&seq)
+	case StartMessage:
+		err = tx.QueryRow("SELECT seq FROM messages WHERE id = ?;", pos.ID).Scan(&seq)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrMessageNotFound
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("scanning row: %w", err)
+	}
+	return seq, nil
+}
+
+// queryLogMessages selects the messages with their delivery state for the consumer, that match the query.
+// It returns the sequence numbers of the messages too.
+func queryLogMessages(db *sql.DB, query string, consumer Consumer, args ...any) ([]Message, []int64, error) {
+	rows, err := db.Query(logMessagesQuery+query, append([]any{consumer}, args...)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("querying messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs := []Message{}
+	seqs := []int64{}
+	for rows.Next() {
+		var msg Message
+		var seq int64
+		var deliverAt, expiresAt, visibleAt sql.NullTime
+		err = rows.Scan(
+			&seq,
+			&msg.ID,
+			&msg.CreatedAt,
+			&msg.Data,
+			&msg.Headers,
+			&msg.Priority,
+			&deliverAt,
+			&expiresAt,
+			&msg.Acked,
+			&visibleAt,
+			&msg.DeliveryAttempts,
+			&msg.LastError,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scanning row: %w", err)
+		}
+		msg.DeliverAt = deliverAt.Time
+		msg.ExpiresAt = expiresAt.Time
+		msg.VisibleAt = visibleAt.Time
+		msgs = append(msgs, msg)
+		seqs = append(seqs, seq)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading rows: %w", err)
+	}
+
+	return msgs, seqs, nil
+}
+
+// execDeliveries executes the update of the delivery state once for every message id, in one transaction.
+// Delivery state is created first, for the messages that were never delivered to the consumer.
+// The consumer and the id are passed after all the other arguments.
+func execDeliveries(db *sql.DB, consumer Consumer, query string, ids []string, args ...any) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ensure, err := tx.Prepare(ensureDeliveryQuery)
+	if err != nil {
+		return fmt.Errorf("preparing statement: %w", err)
+	}
+	defer ensure.Close()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("preparing statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, id := range ids {
+		_, err = ensure.Exec(consumer, consumer, id)
+		if err != nil {
+			return fmt.Errorf("inserting delivery: %w", err)
+		}
+		_, err = stmt.Exec(append(args, consumer, id)...)
+		if err != nil {
+			return fmt.Errorf("executing statement: %w", err)
+		}
+	}
+
+	return tx.Commit()
 }
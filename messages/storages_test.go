@@ -0,0 +1,900 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tobias-piotr/leshy/internal/sqlite"
+)
+
+// useTempDir makes the SQLite storages keep the databases in a directory, that is removed once the test is done.
+func useTempDir(t *testing.T) {
+	t.Helper()
+	dir := sqlite.Dir()
+	sqlite.SetDir(t.TempDir())
+	t.Cleanup(func() { sqlite.SetDir(dir) })
+}
+
+// newStorages returns one storage of every kind, keeping the databases in a temporary directory.
+func newStorages(t *testing.T) map[StorageKind]Storage {
+	useTempDir(t)
+	return map[StorageKind]Storage{
+		StorageSQLite:    NewDistributedSQLStorage(NewConnectionMap()),
+		StorageSQLiteLog: NewLogSQLStorage(NewConnectionMap()),
+		StorageMemory:    NewMemoryStorage(),
+	}
+}
+
+// forEachStorage runs the test against every storage, removing given queue once it's done.
+func forEachStorage(t *testing.T, queue Queue, test func(t *testing.T, storage Storage)) {
+	for kind, storage := range newStorages(t) {
+		t.Run(string(kind), func(t *testing.T) {
+			t.Cleanup(func() {
+				err := storage.DeleteQueue(queue)
+				if err != nil {
+					t.Error(err)
+				}
+			})
+			test(t, storage)
+		})
+	}
+}
+
+// insert saves n new messages in the queue, and returns their ids.
+func insert(t *testing.T, storage Storage, queue Queue, n int) []string {
+	t.Helper()
+	msgs := make([]Message, n)
+	ids := make([]string, n)
+	for i := range msgs {
+		ids[i] = uuid.New().String()
+		msgs[i] = Message{ID: ids[i], Data: []byte(fmt.Sprint(i))}
+	}
+	_, err := storage.InsertMany(queue, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestTrimAckedRetention(t *testing.T) {
+	forEachStorage(t, "trim-acked", func(t *testing.T, storage Storage) {
+		queue := Queue("trim-acked")
+		err := storage.Subscribe(queue, "worker", StartPosition{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := insert(t, storage, queue, 3)
+		err = storage.Ack(queue, "worker", ids[:2]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// created_at has second precision
+		time.Sleep(1100 * time.Millisecond)
+		consumers, err := storage.Consumers(queue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, consumer := range consumers {
+			_, err := storage.Trim(queue, consumer, Retention{AckedMaxAge: time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		stats, err := storage.Stats(queue, "worker")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Acked != 0 || stats.Pending != 1 {
+			t.Fatalf("expected only the unacked message to be kept, got %+v", stats)
+		}
+		// The main consumer never read the queue, so it keeps the messages for the consumers created later
+		if _, err := storage.Get(queue, Consumer(queue), ids[2]); err != nil {
+			t.Fatalf("unacked message removed: %v", err)
+		}
+	})
+}
+
+func TestTrimKeepsMessagesWithoutConsumers(t *testing.T) {
+	forEachStorage(t, "trim-main", func(t *testing.T, storage Storage) {
+		queue := Queue("trim-main")
+		insert(t, storage, queue, 2)
+
+		time.Sleep(1100 * time.Millisecond)
+		removed, err := storage.Trim(queue, Consumer(queue), Retention{AckedMaxAge: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != 0 {
+			t.Fatalf("%d unread messages removed", removed)
+		}
+	})
+}
+
+func TestGetAllAfterAcks(t *testing.T) {
+	forEachStorage(t, "get-all-acks", func(t *testing.T, storage Storage) {
+		queue := Queue("get-all-acks")
+		ids := insert(t, storage, queue, 5)
+		pending := func(expected ...string) {
+			t.Helper()
+			msgs, err := storage.GetAll(queue, "", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(msgs))
+			for i, msg := range msgs {
+				got[i] = msg.ID
+			}
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Fatalf("expected pending %v, got %v", expected, got)
+			}
+		}
+
+		err := storage.Ack(queue, "", ids[0], ids[1], ids[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending(ids[2], ids[4])
+
+		err = storage.Requeue(queue, "", Message{ID: ids[0]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending(ids[0], ids[2], ids[4])
+
+		err = storage.Ack(queue, "", ids[0], ids[2], ids[4])
+		if err != nil {
+			t.Fatal(err)
+		}
+		pending()
+
+		more := insert(t, storage, queue, 1)
+		pending(more...)
+	})
+}
+
+func TestLogStartFollowsAcks(t *testing.T) {
+	useTempDir(t)
+	storage := NewLogSQLStorage(NewConnectionMap())
+	queue := Queue("log-start")
+	t.Cleanup(func() { storage.DeleteQueue(queue) })
+
+	ids := insert(t, storage, queue, 4)
+	startSeq := func() int64 {
+		t.Helper()
+		conn, err := storage.getConn(queue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var seq int64
+		err = conn.DB.QueryRow("SELECT start_seq FROM consumers WHERE name = ?;", queue).Scan(&seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return seq
+	}
+
+	// The start stops at the first message that is not acked
+	err := storage.Ack(queue, "", ids[0], ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq := startSeq(); seq != 2 {
+		t.Fatalf("expected start at 2, got %d", seq)
+	}
+
+	err = storage.Ack(queue, "", ids[1], ids[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq := startSeq(); seq != 5 {
+		t.Fatalf("expected start after the last message, got %d", seq)
+	}
+}
+
+func TestInsertManyReportsNewMessages(t *testing.T) {
+	forEachStorage(t, "insert-new", func(t *testing.T, storage Storage) {
+		queue := Queue("insert-new")
+		ids := insert(t, storage, queue, 2)
+
+		msgs := []Message{{ID: ids[0]}, {ID: "new"}, {ID: "new"}}
+		inserted, err := storage.InsertMany(queue, msgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(inserted) != 1 || !inserted["new"] {
+			t.Fatalf("expected only the new message to be reported, got %v", inserted)
+		}
+	})
+}
+
+func TestClaimOnce(t *testing.T) {
+	forEachStorage(t, "claim", func(t *testing.T, storage Storage) {
+		queue := Queue("claim")
+		ids := insert(t, storage, queue, 2)
+		err := storage.Ack(queue, "", ids[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, expected := range []bool{true, false} {
+			claimed, err := storage.Claim(queue, "", ids[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claimed != expected {
+				t.Fatalf("claim %d: expected %v, got %v", i, expected, claimed)
+			}
+		}
+		claimed, err := storage.Claim(queue, "", ids[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed {
+			t.Fatal("acked message claimed")
+		}
+	})
+}
+
+func TestGetDeadLettersMissingQueue(t *testing.T) {
+	for kind, storage := range newStorages(t) {
+		t.Run(string(kind), func(t *testing.T) {
+			_, err := storage.GetDeadLetters("missing.dlq", DeadLetterFilter{})
+			if !errors.Is(err, ErrQueueNotFound) {
+				t.Fatalf("expected ErrQueueNotFound, got %v", err)
+			}
+			queues, err := storage.Queues()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slices.Contains(queues, "missing.dlq") {
+				t.Fatal("dead-letter queue created by the listing")
+			}
+		})
+	}
+}
+
+func TestSubscribeFromPosition(t *testing.T) {
+	forEachStorage(t, "subscribe-position", func(t *testing.T, storage Storage) {
+		queue := Queue("subscribe-position")
+		ids := insert(t, storage, queue, 3)
+
+		err := storage.Subscribe(queue, "latest", StartPosition{Kind: StartLatest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.Subscribe(queue, "message", StartPosition{Kind: StartMessage, ID: ids[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		more := insert(t, storage, queue, 1)
+
+		for consumer, expected := range map[Consumer][]string{"latest": more, "message": {ids[1], ids[2], more[0]}} {
+			msgs, err := storage.GetAll(queue, consumer, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(msgs))
+			for i, msg := range msgs {
+				got[i] = msg.ID
+			}
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Fatalf("consumer %s: expected pending %v, got %v", consumer, expected, got)
+			}
+		}
+	})
+}
+
+func TestSubscribeCopiesOnlyFromPosition(t *testing.T) {
+	useTempDir(t)
+	storage := NewDistributedSQLStorage(NewConnectionMap())
+	queue := Queue("subscribe-copy")
+	t.Cleanup(func() { storage.DeleteQueue(queue) })
+
+	insert(t, storage, queue, 3)
+	err := storage.Subscribe(queue, "latest", StartPosition{Kind: StartLatest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := storage.getConsumerConn(queue, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	err = conn.DB.QueryRow("SELECT COUNT(*) FROM messages;").Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("%d messages copied for the consumer starting at the latest", n)
+	}
+}
+
+func TestConcurrentSubscribeSeesFullCopy(t *testing.T) {
+	useTempDir(t)
+	storage := NewDistributedSQLStorage(NewConnectionMap())
+	queue := Queue("subscribe-concurrent")
+	t.Cleanup(func() { storage.DeleteQueue(queue) })
+
+	insert(t, storage, queue, 200)
+	errs := make(chan error, 10)
+	for range 10 {
+		go func() {
+			err := storage.Subscribe(queue, "worker", StartPosition{Kind: StartEarliest})
+			if err != nil {
+				errs <- err
+				return
+			}
+			conn, err := storage.getConsumerConn(queue, "worker")
+			if err != nil {
+				errs <- err
+				return
+			}
+			var n int
+			err = conn.DB.QueryRow("SELECT COUNT(*) FROM messages;").Scan(&n)
+			if err == nil && n != 200 {
+				err = fmt.Errorf("subscribed consumer has %d of 200 messages", n)
+			}
+			errs <- err
+		}()
+	}
+	for range 10 {
+		err := <-errs
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSeekBeforeConsumerStart(t *testing.T) {
+	forEachStorage(t, "seek-before-start", func(t *testing.T, storage Storage) {
+		queue := Queue("seek-before-start")
+		ids := insert(t, storage, queue, 3)
+		err := storage.Subscribe(queue, "late", StartPosition{Kind: StartLatest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, insert(t, storage, queue, 2)...)
+		err = storage.Ack(queue, "late", ids[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The whole queue is replayed, including the messages published before the consumer was created
+		replayed, skipped, err := storage.Seek(queue, "late", StartPosition{Kind: StartMessage, ID: ids[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayed != 3 || skipped != 0 {
+			t.Fatalf("expected 3 replayed and 0 skipped, got %d and %d", replayed, skipped)
+		}
+		replayed, skipped, err = storage.Seek(queue, "late", StartPosition{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayed != 1 || skipped != 0 {
+			t.Fatalf("expected 1 replayed and 0 skipped, got %d and %d", replayed, skipped)
+		}
+
+		msgs, _, err := storage.Browse(queue, "late", BrowseFilter{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, len(msgs))
+		for i, msg := range msgs {
+			got[i] = msg.ID
+		}
+		if fmt.Sprint(got) != fmt.Sprint(ids) {
+			t.Fatalf("expected messages in publish order %v, got %v", ids, got)
+		}
+		pending, err := storage.GetAll(queue, "late", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != len(ids) {
+			t.Fatalf("expected all %d messages pending, got %d", len(ids), len(pending))
+		}
+	})
+}
+
+func TestPurgeCountsPerConsumer(t *testing.T) {
+	forEachStorage(t, "purge-count", func(t *testing.T, storage Storage) {
+		queue := Queue("purge-count")
+		insert(t, storage, queue, 3)
+		err := storage.Subscribe(queue, "late", StartPosition{Kind: StartLatest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		insert(t, storage, queue, 2)
+
+		removed, err := storage.Purge(queue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed[Consumer(queue)] != 5 || removed["late"] != 2 {
+			t.Fatalf("expected 5 messages removed for main and 2 for the late consumer, got %v", removed)
+		}
+		for _, consumer := range []Consumer{Consumer(queue), "late"} {
+			msgs, _, err := storage.Browse(queue, consumer, BrowseFilter{Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 0 {
+				t.Fatalf("consumer %s has %d messages left after the purge", consumer, len(msgs))
+			}
+		}
+	})
+}
+
+func TestCloseIdleClosesConnections(t *testing.T) {
+	useTempDir(t)
+	storage := NewLogSQLStorage(NewConnectionMap())
+	queue := Queue("close-idle")
+	t.Cleanup(func() { storage.DeleteQueue(queue) })
+
+	insert(t, storage, queue, 1)
+	conn := storage.connMap.Get(queue, Consumer(queue))
+	conn.TTL = time.Now()
+	removed, err := storage.CloseIdle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 connection removed, got %d", removed)
+	}
+	if conn.DB.Ping() == nil {
+		t.Fatal("removed connection is still open")
+	}
+}
+
+func TestReopenSkipsMigrations(t *testing.T) {
+	useTempDir(t)
+	storage := NewLogSQLStorage(NewConnectionMap())
+	queue := Queue("reopen-migrated")
+	t.Cleanup(func() { storage.DeleteQueue(queue) })
+
+	insert(t, storage, queue, 1)
+	conn := storage.connMap.Get(queue, Consumer(queue))
+	// Running the migrations again would fail, because the columns they add already exist
+	_, err := conn.DB.Exec("PRAGMA user_version = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.TTL = time.Now()
+	_, err = storage.CloseIdle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert(t, storage, queue, 1)
+}
+
+func TestLeaseHidesMessages(t *testing.T) {
+	forEachStorage(t, "lease", func(t *testing.T, storage Storage) {
+		queue := Queue("lease")
+		ids := insert(t, storage, queue, 2)
+
+		leased, err := storage.Lease(queue, Consumer(queue), ids[:1], 200*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !leased[ids[0]] {
+			t.Fatal("message was not leased")
+		}
+		leased, err = storage.Lease(queue, Consumer(queue), ids[:1], time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if leased[ids[0]] {
+			t.Fatal("message was leased twice")
+		}
+		msgs, err := storage.GetAll(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 1 || msgs[0].ID != ids[1] {
+			t.Fatalf("expected only the message that is not leased, got %v", msgs)
+		}
+
+		time.Sleep(250 * time.Millisecond)
+		msgs, err = storage.GetAll(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 2 {
+			t.Fatalf("expected the message to be visible once the lease expired, got %d messages", len(msgs))
+		}
+		msg, err := storage.Get(queue, Consumer(queue), ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.DeliveryAttempts != 1 {
+			t.Fatalf("expected 1 delivery attempt, got %d", msg.DeliveryAttempts)
+		}
+	})
+}
+
+func TestNackDelaysRedelivery(t *testing.T) {
+	forEachStorage(t, "nack", func(t *testing.T, storage Storage) {
+		queue := Queue("nack")
+		ids := insert(t, storage, queue, 1)
+		_, err := storage.Lease(queue, Consumer(queue), ids, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = storage.Nack(queue, Consumer(queue), 200*time.Millisecond, "broken", ids...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs, err := storage.GetAll(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 0 {
+			t.Fatal("nacked message delivered before the delay")
+		}
+		msg, err := storage.Get(queue, Consumer(queue), ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.LastError != "broken" {
+			t.Fatalf("expected the reason to be recorded, got %q", msg.LastError)
+		}
+
+		time.Sleep(250 * time.Millisecond)
+		msgs, err = storage.GetAll(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 1 {
+			t.Fatal("nacked message not delivered after the delay")
+		}
+	})
+}
+
+func TestScheduledMessagesWaitForDelivery(t *testing.T) {
+	forEachStorage(t, "scheduled", func(t *testing.T, storage Storage) {
+		queue := Queue("scheduled")
+		scheduled := Message{ID: uuid.New().String(), DeliverAt: time.Now().Add(500 * time.Millisecond)}
+		_, err := storage.InsertMany(queue, []Message{scheduled, {ID: uuid.New().String()}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs, err := storage.GetAll(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 1 || msgs[0].ID == scheduled.ID {
+			t.Fatalf("expected only the message that is due, got %v", msgs)
+		}
+		stats, err := storage.Stats(queue, Consumer(queue))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Scheduled != 1 || stats.Pending != 1 {
+			t.Fatalf("expected 1 scheduled and 1 pending message, got %+v", stats)
+		}
+
+		time.Sleep(time.Until(scheduled.DeliverAt))
+		msgs, err = storage.GetAll(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 2 {
+			t.Fatalf("expected the scheduled message once it's due, got %d messages", len(msgs))
+		}
+	})
+}
+
+func TestHeadersRoundTrip(t *testing.T) {
+	forEachStorage(t, "headers", func(t *testing.T, storage Storage) {
+		queue := Queue("headers")
+		headers := Headers{"content-type": "application/json", "tenant": "acme"}
+		id := uuid.New().String()
+		_, err := storage.InsertMany(queue, []Message{{ID: id, Headers: headers}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Consumers created later get the headers copied
+		err = storage.Subscribe(queue, "worker", StartPosition{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, consumer := range []Consumer{Consumer(queue), "worker"} {
+			msg, err := storage.Get(queue, consumer, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(msg.Headers) != fmt.Sprint(headers) {
+				t.Fatalf("consumer %s: expected headers %v, got %v", consumer, headers, msg.Headers)
+			}
+			msgs, err := storage.GetAll(queue, consumer, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 1 || fmt.Sprint(msgs[0].Headers) != fmt.Sprint(headers) {
+				t.Fatalf("consumer %s: expected headers %v delivered, got %v", consumer, headers, msgs)
+			}
+		}
+	})
+}
+
+func TestInsertManyReachesEveryConsumer(t *testing.T) {
+	forEachStorage(t, "insert-many", func(t *testing.T, storage Storage) {
+		queue := Queue("insert-many")
+		err := storage.Subscribe(queue, "worker", StartPosition{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		insert(t, storage, queue, 500)
+
+		for _, consumer := range []Consumer{Consumer(queue), "worker"} {
+			msgs, err := storage.GetAll(queue, consumer, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 500 {
+				t.Fatalf("consumer %s has %d of 500 messages", consumer, len(msgs))
+			}
+		}
+	})
+}
+
+func TestStatsCountsMessageStates(t *testing.T) {
+	forEachStorage(t, "stats", func(t *testing.T, storage Storage) {
+		queue := Queue("stats")
+		err := storage.Subscribe(queue, "worker", StartPosition{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := insert(t, storage, queue, 4)
+		err = storage.Ack(queue, "worker", ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = storage.Lease(queue, "worker", ids[1:2], time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stats, err := storage.Stats(queue, "worker")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Pending != 2 || stats.InFlight != 1 || stats.Acked != 1 || stats.OldestUnacked.IsZero() {
+			t.Fatalf("expected 2 pending, 1 in-flight and 1 acked message, got %+v", stats)
+		}
+
+		queues, err := storage.Queues()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(queues, queue) {
+			t.Fatalf("queue %s not listed in %v", queue, queues)
+		}
+		consumers, err := storage.Consumers(queue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(consumers) != fmt.Sprint([]Consumer{Consumer(queue), "worker"}) {
+			t.Fatalf("expected the main and worker consumers, got %v", consumers)
+		}
+	})
+}
+
+func TestDeleteConsumerAndQueue(t *testing.T) {
+	for kind, storage := range newStorages(t) {
+		t.Run(string(kind), func(t *testing.T) {
+			queue := Queue("delete")
+			err := storage.Subscribe(queue, "worker", StartPosition{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			insert(t, storage, queue, 2)
+
+			err = storage.DeleteConsumer(queue, Consumer(queue))
+			if !errors.Is(err, ErrMainConsumer) {
+				t.Fatalf("expected %v, got %v", ErrMainConsumer, err)
+			}
+			err = storage.DeleteConsumer(queue, "worker")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Deleted consumer doesn't get the copies of new messages
+			insert(t, storage, queue, 1)
+			consumers, err := storage.Consumers(queue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slices.Contains(consumers, "worker") {
+				t.Fatalf("deleted consumer is still listed in %v", consumers)
+			}
+
+			err = storage.DeleteQueue(queue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			queues, err := storage.Queues()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slices.Contains(queues, queue) {
+				t.Fatalf("deleted queue is still listed in %v", queues)
+			}
+			_, err = storage.Consumers(queue)
+			if !errors.Is(err, ErrQueueNotFound) {
+				t.Fatalf("expected %v, got %v", ErrQueueNotFound, err)
+			}
+		})
+	}
+}
+
+func TestBrowsePages(t *testing.T) {
+	forEachStorage(t, "browse", func(t *testing.T, storage Storage) {
+		queue := Queue("browse")
+		ids := insert(t, storage, queue, 5)
+		err := storage.Ack(queue, Consumer(queue), ids[1], ids[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for status, expected := range map[MessageStatus][]string{
+			StatusAll:     ids,
+			StatusPending: {ids[0], ids[2], ids[4]},
+			StatusAcked:   {ids[1], ids[3]},
+		} {
+			got := []string{}
+			filter := BrowseFilter{Status: status, Limit: 2}
+			for {
+				msgs, next, err := storage.Browse(queue, Consumer(queue), filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, msg := range msgs {
+					got = append(got, msg.ID)
+				}
+				if next == 0 {
+					break
+				}
+				filter.After = next
+			}
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Fatalf("status %d: expected %v, got %v", status, expected, got)
+			}
+		}
+
+		// Browsing doesn't lease the messages
+		msgs, err := storage.GetAll(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 3 {
+			t.Fatalf("expected 3 pending messages after browsing, got %d", len(msgs))
+		}
+	})
+}
+
+func TestSeekForwardAndBack(t *testing.T) {
+	forEachStorage(t, "seek", func(t *testing.T, storage Storage) {
+		queue := Queue("seek")
+		ids := insert(t, storage, queue, 4)
+		err := storage.Ack(queue, Consumer(queue), ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Forward, the unacked messages before the position are skipped
+		replayed, skipped, err := storage.Seek(queue, Consumer(queue), StartPosition{Kind: StartMessage, ID: ids[2]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayed != 0 || skipped != 1 {
+			t.Fatalf("expected 0 replayed and 1 skipped, got %d and %d", replayed, skipped)
+		}
+		msgs, err := storage.GetAll(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 2 || msgs[0].ID != ids[2] {
+			t.Fatalf("expected messages since the position, got %v", msgs)
+		}
+
+		// Back, the acked messages since the position are replayed
+		err = storage.Ack(queue, Consumer(queue), ids[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed, skipped, err = storage.Seek(queue, Consumer(queue), StartPosition{Kind: StartMessage, ID: ids[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayed != 2 || skipped != 0 {
+			t.Fatalf("expected 2 replayed and 0 skipped, got %d and %d", replayed, skipped)
+		}
+
+		_, _, err = storage.Seek(queue, "missing", StartPosition{})
+		if !errors.Is(err, ErrConsumerNotFound) {
+			t.Fatalf("expected %v, got %v", ErrConsumerNotFound, err)
+		}
+	})
+}
+
+func TestMemoryQueuesKeepNoFiles(t *testing.T) {
+	useTempDir(t)
+	config := NewConfig()
+	config.Queues["memory"] = QueueOptions{Storage: StorageMemory}
+	storage, err := NewStorage(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert(t, storage, "memory", 1)
+	entries, err := os.ReadDir(sqlite.Dir())
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("memory queue left files behind: %v", entries)
+	}
+
+	insert(t, storage, "disk", 1)
+	queues, err := storage.Queues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(queues) != fmt.Sprint([]Queue{"disk", "memory"}) {
+		t.Fatalf("expected queues of both storages, got %v", queues)
+	}
+}
+
+func TestExpiredMessagesNotDelivered(t *testing.T) {
+	forEachStorage(t, "expired", func(t *testing.T, storage Storage) {
+		queue := Queue("expired")
+		expired := Message{ID: uuid.New().String(), ExpiresAt: time.Now().Add(-time.Second)}
+		live := Message{ID: uuid.New().String(), ExpiresAt: time.Now().Add(time.Hour)}
+		_, err := storage.InsertMany(queue, []Message{expired, live})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs, err := storage.GetAll(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 1 || msgs[0].ID != live.ID {
+			t.Fatalf("expected only the message that didn't expire, got %v", msgs)
+		}
+		leased, err := storage.Lease(queue, Consumer(queue), []string{expired.ID}, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if leased[expired.ID] {
+			t.Fatal("expired message was leased")
+		}
+
+		msgs, err = storage.GetExpired(queue, Consumer(queue), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 1 || msgs[0].ID != expired.ID {
+			t.Fatalf("expected the expired message, got %v", msgs)
+		}
+		removed, err := storage.DeleteExpired(queue, Consumer(queue))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != 1 {
+			t.Fatalf("expected 1 expired message removed, got %d", removed)
+		}
+	})
+}
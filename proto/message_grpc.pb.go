@@ -19,8 +19,12 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	MessageService_PublishMessage_FullMethodName = "/jobs.MessageService/PublishMessage"
-	MessageService_ReadMessages_FullMethodName   = "/jobs.MessageService/ReadMessages"
+	MessageService_PublishMessage_FullMethodName  = "/jobs.MessageService/PublishMessage"
+	MessageService_PublishMessages_FullMethodName = "/jobs.MessageService/PublishMessages"
+	MessageService_PublishStream_FullMethodName   = "/jobs.MessageService/PublishStream"
+	MessageService_ReadMessages_FullMethodName    = "/jobs.MessageService/ReadMessages"
+	MessageService_ReceiveMessages_FullMethodName = "/jobs.MessageService/ReceiveMessages"
+	MessageService_AckMessages_FullMethodName     = "/jobs.MessageService/AckMessages"
 )
 
 // MessageServiceClient is the client API for MessageService service.
@@ -28,7 +32,11 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type MessageServiceClient interface {
 	PublishMessage(ctx context.Context, in *MessageRequest, opts ...grpc.CallOption) (*MessageResponse, error)
+	PublishMessages(ctx context.Context, in *MessagesRequest, opts ...grpc.CallOption) (*MessagesResponse, error)
+	PublishStream(ctx context.Context, opts ...grpc.CallOption) (MessageService_PublishStreamClient, error)
 	ReadMessages(ctx context.Context, opts ...grpc.CallOption) (MessageService_ReadMessagesClient, error)
+	ReceiveMessages(ctx context.Context, in *ReceiveRequest, opts ...grpc.CallOption) (*ReceiveResponse, error)
+	AckMessages(ctx context.Context, in *AckRequest, opts ...grpc.CallOption) (*AckResponse, error)
 }
 
 type messageServiceClient struct {
@@ -48,8 +56,48 @@ func (c *messageServiceClient) PublishMessage(ctx context.Context, in *MessageRe
 	return out, nil
 }
 
+func (c *messageServiceClient) PublishMessages(ctx context.Context, in *MessagesRequest, opts ...grpc.CallOption) (*MessagesResponse, error) {
+	out := new(MessagesResponse)
+	err := c.cc.Invoke(ctx, MessageService_PublishMessages_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *messageServiceClient) PublishStream(ctx context.Context, opts ...grpc.CallOption) (MessageService_PublishStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MessageService_ServiceDesc.Streams[0], MessageService_PublishStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &messageServicePublishStreamClient{stream}
+	return x, nil
+}
+
+type MessageService_PublishStreamClient interface {
+	Send(*MessageRequest) error
+	Recv() (*PublishConfirm, error)
+	grpc.ClientStream
+}
+
+type messageServicePublishStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *messageServicePublishStreamClient) Send(m *MessageRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *messageServicePublishStreamClient) Recv() (*PublishConfirm, error) {
+	m := new(PublishConfirm)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *messageServiceClient) ReadMessages(ctx context.Context, opts ...grpc.CallOption) (MessageService_ReadMessagesClient, error) {
-	stream, err := c.cc.NewStream(ctx, &MessageService_ServiceDesc.Streams[0], MessageService_ReadMessages_FullMethodName, opts...)
+	stream, err := c.cc.NewStream(ctx, &MessageService_ServiceDesc.Streams[1], MessageService_ReadMessages_FullMethodName, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -79,12 +127,34 @@ func (x *messageServiceReadMessagesClient) Recv() (*MessageStreamResponse, error
 	return m, nil
 }
 
+func (c *messageServiceClient) ReceiveMessages(ctx context.Context, in *ReceiveRequest, opts ...grpc.CallOption) (*ReceiveResponse, error) {
+	out := new(ReceiveResponse)
+	err := c.cc.Invoke(ctx, MessageService_ReceiveMessages_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *messageServiceClient) AckMessages(ctx context.Context, in *AckRequest, opts ...grpc.CallOption) (*AckResponse, error) {
+	out := new(AckResponse)
+	err := c.cc.Invoke(ctx, MessageService_AckMessages_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MessageServiceServer is the server API for MessageService service.
 // All implementations must embed UnimplementedMessageServiceServer
 // for forward compatibility
 type MessageServiceServer interface {
 	PublishMessage(context.Context, *MessageRequest) (*MessageResponse, error)
+	PublishMessages(context.Context, *MessagesRequest) (*MessagesResponse, error)
+	PublishStream(MessageService_PublishStreamServer) error
 	ReadMessages(MessageService_ReadMessagesServer) error
+	ReceiveMessages(context.Context, *ReceiveRequest) (*ReceiveResponse, error)
+	AckMessages(context.Context, *AckRequest) (*AckResponse, error)
 	mustEmbedUnimplementedMessageServiceServer()
 }
 
@@ -95,9 +165,21 @@ type UnimplementedMessageServiceServer struct {
 func (UnimplementedMessageServiceServer) PublishMessage(context.Context, *MessageRequest) (*MessageResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PublishMessage not implemented")
 }
+func (UnimplementedMessageServiceServer) PublishMessages(context.Context, *MessagesRequest) (*MessagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublishMessages not implemented")
+}
+func (UnimplementedMessageServiceServer) PublishStream(MessageService_PublishStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method PublishStream not implemented")
+}
 func (UnimplementedMessageServiceServer) ReadMessages(MessageService_ReadMessagesServer) error {
 	return status.Errorf(codes.Unimplemented, "method ReadMessages not implemented")
 }
+func (UnimplementedMessageServiceServer) ReceiveMessages(context.Context, *ReceiveRequest) (*ReceiveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReceiveMessages not implemented")
+}
+func (UnimplementedMessageServiceServer) AckMessages(context.Context, *AckRequest) (*AckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AckMessages not implemented")
+}
 func (UnimplementedMessageServiceServer) mustEmbedUnimplementedMessageServiceServer() {}
 
 // UnsafeMessageServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -129,6 +211,50 @@ func _MessageService_PublishMessage_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MessageService_PublishMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MessageServiceServer).PublishMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MessageService_PublishMessages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MessageServiceServer).PublishMessages(ctx, req.(*MessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MessageService_PublishStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MessageServiceServer).PublishStream(&messageServicePublishStreamServer{stream})
+}
+
+type MessageService_PublishStreamServer interface {
+	Send(*PublishConfirm) error
+	Recv() (*MessageRequest, error)
+	grpc.ServerStream
+}
+
+type messageServicePublishStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *messageServicePublishStreamServer) Send(m *PublishConfirm) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *messageServicePublishStreamServer) Recv() (*MessageRequest, error) {
+	m := new(MessageRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _MessageService_ReadMessages_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(MessageServiceServer).ReadMessages(&messageServiceReadMessagesServer{stream})
 }
@@ -155,6 +281,42 @@ func (x *messageServiceReadMessagesServer) Recv() (*MessageStreamRequest, error)
 	return m, nil
 }
 
+func _MessageService_ReceiveMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReceiveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MessageServiceServer).ReceiveMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MessageService_ReceiveMessages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MessageServiceServer).ReceiveMessages(ctx, req.(*ReceiveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MessageService_AckMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MessageServiceServer).AckMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MessageService_AckMessages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MessageServiceServer).AckMessages(ctx, req.(*AckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MessageService_ServiceDesc is the grpc.ServiceDesc for MessageService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -166,8 +328,26 @@ var MessageService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PublishMessage",
 			Handler:    _MessageService_PublishMessage_Handler,
 		},
+		{
+			MethodName: "PublishMessages",
+			Handler:    _MessageService_PublishMessages_Handler,
+		},
+		{
+			MethodName: "ReceiveMessages",
+			Handler:    _MessageService_ReceiveMessages_Handler,
+		},
+		{
+			MethodName: "AckMessages",
+			Handler:    _MessageService_AckMessages_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PublishStream",
+			Handler:       _MessageService_PublishStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 		{
 			StreamName:    "ReadMessages",
 			Handler:       _MessageService_ReadMessages_Handler,